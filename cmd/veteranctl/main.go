@@ -0,0 +1,240 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/client"
+	"github.com/QQGoblin/veteran/pkg/config"
+	"github.com/QQGoblin/veteran/pkg/tlsutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: veteranctl [flags] <command> [args]
+
+Commands:
+  status                                         show cluster status
+  members                                        list members
+  member add [--non-voter] [--priority N] [--api-address URL] <id> <address>
+                                                 add member on leader
+  member remove <id>                             remove member on leader
+  member priority <id> <value>                   set member priority
+  leader transfer [--hold DURATION] [id]         transfer leadership and pause preemption
+  leader resume                                  resume preemption paused by leader transfer
+  kv get [--consistent] <key>                    read key
+  kv put [--prev-value V] [--prev-exist=false] <key> <value>
+                                                 write key
+  kv del <key>                                   delete key
+
+Flags:
+`
+
+type command func(c *client.Client, out *printer, args []string) error
+
+var commands = map[string]command{
+	"status":  statusCommand,
+	"members": membersCommand,
+	"member":  memberCommand,
+	"leader":  leaderCommand,
+	"kv":      kvCommand,
+}
+
+func main() {
+
+	flags := flag.NewFlagSet("veteranctl", flag.ExitOnError)
+	endpoints := flags.String("endpoints", "127.0.0.1:27000", "comma separated api endpoints, leader is discovered automatically")
+	output := flags.String("output", "table", "output format: table, json or yaml")
+	timeout := flags.Duration("timeout", 5*time.Second, "request timeout")
+	cacert := flags.String("cacert", "", "ca file used to verify https endpoints")
+	cert := flags.String("cert", "", "client certificate file")
+	key := flags.String("key", "", "client key file")
+	token := flags.String("token", os.Getenv("VETERAN_TOKEN"), "bearer token, defaults to $VETERAN_TOKEN")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	out, err := newPrinter(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	options := client.Options{Timeout: *timeout, Token: *token}
+	if tlsConfig := (config.TLSConfig{CA: *cacert, Cert: *cert, Key: *key}); tlsConfig.Enabled() {
+		if options.TLS, err = tlsutil.ClientConfig(tlsConfig); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	c, err := client.New(strings.Split(*endpoints, ","), options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if err = cmd(c, out, args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func statusCommand(c *client.Client, out *printer, _ []string) error {
+
+	state, err := c.Status()
+	if err != nil {
+		return err
+	}
+	return out.status(state)
+}
+
+func membersCommand(c *client.Client, out *printer, _ []string) error {
+
+	state, err := c.Status()
+	if err != nil {
+		return err
+	}
+	return out.members(state)
+}
+
+func memberCommand(c *client.Client, _ *printer, args []string) error {
+
+	if len(args) == 0 {
+		return fmt.Errorf("member requires a subcommand: add, remove or priority")
+	}
+
+	switch args[0] {
+	case "add":
+		flags := flag.NewFlagSet("member add", flag.ContinueOnError)
+		nonVoter := flags.Bool("non-voter", false, "add member as non-voter")
+		priority := flags.Int("priority", 0, "member priority")
+		apiAddress := flags.String("api-address", "", "api address advertised by the member, e.g. http://172.28.117.3:27000")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 2 {
+			return fmt.Errorf("usage: member add [--non-voter] [--priority N] [--api-address URL] <id> <address>")
+		}
+		var p *int
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "priority" {
+				p = priority
+			}
+		})
+		return c.AddMember(flags.Arg(0), flags.Arg(1), *apiAddress, *nonVoter, p)
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: member remove <id>")
+		}
+		return c.DelMember(args[1])
+	case "priority":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: member priority <id> <value>")
+		}
+		value, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid priority %q", args[2])
+		}
+		return c.SetPriority(args[1], value)
+	default:
+		return fmt.Errorf("unknown member subcommand %q", args[0])
+	}
+}
+
+func leaderCommand(c *client.Client, _ *printer, args []string) error {
+
+	if len(args) == 0 {
+		return fmt.Errorf("leader requires a subcommand: transfer or resume")
+	}
+
+	switch args[0] {
+	case "transfer":
+		flags := flag.NewFlagSet("leader transfer", flag.ContinueOnError)
+		hold := flags.Duration("hold", 0, "pause preemption after the transfer, 0 disables the pause")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() > 1 {
+			return fmt.Errorf("usage: leader transfer [--hold DURATION] [id]")
+		}
+		var h *time.Duration
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "hold" {
+				h = hold
+			}
+		})
+		return c.TransferLeader(flags.Arg(0), h)
+	case "resume":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: leader resume")
+		}
+		return c.ResumePreempt()
+	default:
+		return fmt.Errorf("unknown leader subcommand %q", args[0])
+	}
+}
+
+func kvCommand(c *client.Client, out *printer, args []string) error {
+
+	if len(args) == 0 {
+		return fmt.Errorf("kv requires a subcommand: get, put or del")
+	}
+
+	switch args[0] {
+	case "get":
+		flags := flag.NewFlagSet("kv get", flag.ContinueOnError)
+		consistent := flags.Bool("consistent", false, "read from leader after barrier")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: kv get [--consistent] <key>")
+		}
+		value, err := c.Get(flags.Arg(0), *consistent)
+		if err != nil {
+			return err
+		}
+		return out.kv(flags.Arg(0), value)
+	case "put":
+		flags := flag.NewFlagSet("kv put", flag.ContinueOnError)
+		prevValue := flags.String("prev-value", "", "only write when current value equals prev-value")
+		prevExist := flags.Bool("prev-exist", true, "set false to only write when key does not exist")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 2 {
+			return fmt.Errorf("usage: kv put [--prev-value V] [--prev-exist=false] <key> <value>")
+		}
+		var p *string
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "prev-value" {
+				p = prevValue
+			}
+		})
+		return c.Put(flags.Arg(0), flags.Arg(1), p, *prevExist)
+	case "del":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: kv del <key>")
+		}
+		return c.Delete(args[1])
+	default:
+		return fmt.Errorf("unknown kv subcommand %q", args[0])
+	}
+}
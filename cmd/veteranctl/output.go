@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/consensus"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+type memberInfo struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	API      string `json:"api,omitempty"`
+	Suffrage string `json:"suffrage"`
+	Priority int    `json:"priority"`
+	Leader   bool   `json:"leader"`
+}
+
+type kvPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func newPrinter(format string) (*printer, error) {
+
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return &printer{format: format, w: os.Stdout}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+}
+
+func (p *printer) status(state *consensus.ClusterState) error {
+
+	if p.format != outputTable {
+		return p.encode(state)
+	}
+
+	return p.table([]string{"ID", "STATUS", "LEADER", "MEMBERS"}, [][]interface{}{
+		{state.ID, state.Status, state.LeaderID, len(state.Members)},
+	})
+}
+
+func (p *printer) members(state *consensus.ClusterState) error {
+
+	members := make([]memberInfo, 0, len(state.Members))
+	for _, m := range state.Members {
+		members = append(members, memberInfo{
+			ID:       string(m.ID),
+			Address:  string(m.Address),
+			API:      state.APIs[string(m.ID)],
+			Suffrage: m.Suffrage.String(),
+			Priority: state.Priorities[string(m.ID)],
+			Leader:   string(m.ID) == state.LeaderID,
+		})
+	}
+
+	if p.format != outputTable {
+		return p.encode(members)
+	}
+
+	rows := make([][]interface{}, 0, len(members))
+	for _, m := range members {
+		rows = append(rows, []interface{}{m.ID, m.Address, m.API, m.Suffrage, m.Priority, m.Leader})
+	}
+	return p.table([]string{"ID", "ADDRESS", "API", "SUFFRAGE", "PRIORITY", "LEADER"}, rows)
+}
+
+func (p *printer) kv(key, value string) error {
+
+	if p.format != outputTable {
+		return p.encode(kvPair{Key: key, Value: value})
+	}
+
+	_, err := fmt.Fprintln(p.w, value)
+	return err
+}
+
+func (p *printer) table(header []string, rows [][]interface{}) error {
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 3, ' ', 0)
+	for i, h := range header {
+		if i > 0 {
+			_, _ = fmt.Fprint(tw, "\t")
+		}
+		_, _ = fmt.Fprint(tw, h)
+	}
+	_, _ = fmt.Fprintln(tw)
+
+	for _, row := range rows {
+		for i, col := range row {
+			if i > 0 {
+				_, _ = fmt.Fprint(tw, "\t")
+			}
+			_, _ = fmt.Fprint(tw, col)
+		}
+		_, _ = fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+// encode 输出 json 或 yaml，yaml 由 json 转换得到，保证两种格式的字段名一致
+func (p *printer) encode(obj interface{}) error {
+
+	body, err := json.MarshalIndent(obj, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if p.format == outputJSON {
+		_, err = fmt.Fprintln(p.w, string(body))
+		return err
+	}
+
+	var generic interface{}
+	if err = json.Unmarshal(body, &generic); err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(p.w)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(generic); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
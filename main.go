@@ -7,6 +7,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -24,6 +25,13 @@ func main() {
 		os.Exit(-1)
 	}
 
+	level, err := log.ParseLevel(vetreranConfig.LogLevel)
+	if err != nil {
+		log.WithError(err).Error("Parse log level failure")
+		os.Exit(-1)
+	}
+	log.SetLevel(level)
+
 	vetreran, err := pkg.NewVeteran(vetreranConfig)
 	if err != nil {
 		os.Exit(-1)
@@ -35,9 +43,23 @@ func main() {
 	}
 
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range signalChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+
+		reloadConfig, err := config.LoadConfig(*path)
+		if err != nil {
+			log.WithError(err).Error("Reload config failure")
+			continue
+		}
+		if err = vetreran.Reload(reloadConfig); err != nil {
+			log.WithError(err).Error("Reload failure")
+		}
+	}
 
-	<-signalChan
 	vetreran.Stop()
 
 }
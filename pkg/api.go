@@ -2,22 +2,93 @@ package pkg
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"github.com/QQGoblin/veteran/pkg/consensus"
+	"github.com/QQGoblin/veteran/pkg/events"
+	"github.com/QQGoblin/veteran/pkg/metrics"
+	"github.com/QQGoblin/veteran/pkg/tlsutil"
 	"github.com/gorilla/mux"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func (v *Veteran) apiServer() *http.Server {
+const (
+	maxValueSize    = 1 << 20
+	eventsBuffer    = 64
+	eventsKeepAlive = 15 * time.Second
+	// defaultTransferHold 手动转移 leader 后默认暂停抢占的时间
+	defaultTransferHold = time.Hour
+)
+
+type kvPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (v *Veteran) apiServer() (*http.Server, error) {
+
+	transport, err := v.forwardTransport()
+	if err != nil {
+		return nil, err
+	}
+
 	r := mux.NewRouter()
+	r.Use(v.authMiddleware, v.forwardMiddleware(transport))
 
 	r.Methods(http.MethodGet).Path("/status").HandlerFunc(v.StatusHandler)
+	r.Methods(http.MethodGet).Path("/metrics").Handler(metrics.Handler())
+	r.Methods(http.MethodGet, http.MethodHead).Path("/healthz").HandlerFunc(v.HealthzHandler)
+	r.Methods(http.MethodGet, http.MethodHead).Path("/readyz").HandlerFunc(v.ReadyzHandler)
+	r.Methods(http.MethodGet, http.MethodHead).Path("/leader").HandlerFunc(v.LeaderHandler)
 	r.Methods(http.MethodPost).Path("/member/{memberID}").HandlerFunc(v.AddMemberHandler)
 	r.Methods(http.MethodDelete).Path("/member/{memberID}").HandlerFunc(v.DelMemberHandler)
+	r.Methods(http.MethodPut).Path("/member/{memberID}/priority").HandlerFunc(v.SetPriorityHandler)
+	r.Methods(http.MethodPut).Path("/member/{memberID}/state").HandlerFunc(v.SetMemberStateHandler)
+	r.Methods(http.MethodPost).Path("/leader/transfer").HandlerFunc(v.TransferLeaderHandler)
+	r.Methods(http.MethodDelete).Path("/preempt/hold").HandlerFunc(v.ResumePreemptHandler)
+	r.Methods(http.MethodGet).Path("/kv/{key:.+}").HandlerFunc(v.GetKVHandler)
+	r.Methods(http.MethodPut).Path("/kv/{key:.+}").HandlerFunc(v.PutKVHandler)
+	r.Methods(http.MethodDelete).Path("/kv/{key:.+}").HandlerFunc(v.DelKVHandler)
+
+	r.Methods(http.MethodGet).Path("/events").HandlerFunc(v.EventsHandler)
+
+	srv := &http.Server{Addr: v.config.Listen, Handler: r}
+
+	if v.config.APITLS.Enabled() {
+		cert, pool, err := tlsutil.Load(v.config.APITLS.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}
+		// 配置 CA 时校验客户端证书，客户端证书的 CN 用于认证
+		if pool != nil {
+			srv.TLSConfig.ClientCAs = pool
+			srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			if v.config.APITLS.RequireClientCert {
+				srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+	}
+
+	// 关闭 api server 时结束所有事件流，否则 Shutdown 会一直等待长连接
+	var cancel context.CancelFunc
+	v.streamCtx, cancel = context.WithCancel(context.Background())
+	srv.RegisterOnShutdown(cancel)
 
-	return &http.Server{Addr: v.config.Listen, Handler: r}
+	return srv, nil
 
 }
 
@@ -25,28 +96,96 @@ func (v *Veteran) StatusHandler(w http.ResponseWriter, _ *http.Request) {
 
 	state, err := v.core.Status()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		log.WithError(err).Error("Get cluster status failure")
+		writeError(w, http.StatusInternalServerError, codeInternal, err)
 		return
 	}
 
-	body, err := json.Marshal(state)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.WithError(err).Error("Marshal raft status failure")
+	writeJSON(w, http.StatusOK, state)
+}
+
+// HealthzHandler 进程存活即返回 200
+func (v *Veteran) HealthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// ReadyzHandler raft 正在运行并且已知 leader 时返回 200
+func (v *Veteran) ReadyzHandler(w http.ResponseWriter, _ *http.Request) {
+
+	if err := v.core.Ready(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, err.Error())
 		return
 	}
 
-	var prettyJSON bytes.Buffer
-	if err = json.Indent(&prettyJSON, body, "", "    "); err != nil {
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// LeaderHandler 仅在当前 leader 上返回 200，外部负载均衡可以据此将请求直接转发到 leader
+func (v *Veteran) LeaderHandler(w http.ResponseWriter, _ *http.Request) {
+
+	if !v.core.IsLeader() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, "not leader")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(w, "leader")
+}
+
+// EventsHandler 以 server-sent events 格式推送集群事件，types 参数用于过滤事件类型，例如 types=leader,virtual_ip_added
+func (v *Veteran) EventsHandler(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.WithError(err).Error("Format output failure")
+		log.Error("Streaming is not supported")
 		return
 	}
 
+	types := make(map[string]struct{})
+	for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = struct{}{}
+		}
+	}
+
+	ch, cancel := events.Subscribe(eventsBuffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
 	w.WriteHeader(http.StatusOK)
-	_, _ = fmt.Fprintf(w, "%v\n", prettyJSON.String())
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
 
+	for {
+		select {
+		case e := <-ch:
+			if _, ok := types[e.Type]; len(types) != 0 && !ok {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.WithError(err).Error("Marshal event failure")
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		case <-keepAlive.C:
+			_, _ = fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		case <-v.streamCtx.Done():
+			return
+		}
+		flusher.Flush()
+	}
 }
 
 func (v *Veteran) AddMemberHandler(w http.ResponseWriter, r *http.Request) {
@@ -56,11 +195,12 @@ func (v *Veteran) AddMemberHandler(w http.ResponseWriter, r *http.Request) {
 
 	id := vars["memberID"]
 	address := params["address"]
+	apiAddress := params.Get("api_address")
 	nonVote := params["non_voter"]
 
-	if len(address) == 0 {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Error("Member address is not found")
+	if len(address) == 0 || address[0] == "" {
+		log.WithField("id", id).Error("Member address is not found")
+		writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Errorf("address is required"))
 		return
 	}
 
@@ -69,11 +209,31 @@ func (v *Veteran) AddMemberHandler(w http.ResponseWriter, r *http.Request) {
 		addNonVoter = true
 	}
 
-	if err := v.core.AddMember(id, address[0], addNonVoter); err != nil {
-		log.WithError(err).WithFields(log.Fields{"id": id, "address": address[0], "non-voter": addNonVoter}).Error("Add member failure")
-		w.WriteHeader(http.StatusInternalServerError)
+	// 添加成员前先校验优先级，避免成员添加成功后才返回参数错误
+	var priority *int
+	if value := params.Get("priority"); value != "" {
+		p, err := strconv.Atoi(value)
+		if err != nil {
+			log.WithError(err).WithField("priority", value).Error("Member priority is invalid")
+			writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Errorf("invalid priority %q", value))
+			return
+		}
+		priority = &p
+	}
+
+	if err := v.core.AddMember(id, address[0], apiAddress, addNonVoter); err != nil {
+		log.WithError(err).WithFields(log.Fields{"id": id, "address": address[0], "api_address": apiAddress, "non-voter": addNonVoter}).Error("Add member failure")
+		v.writeError(w, r, err)
 		return
 	}
+
+	if priority != nil {
+		if err := v.core.SetPriority(id, *priority); err != nil {
+			log.WithError(err).WithFields(log.Fields{"id": id, "priority": *priority}).Error("Set member priority failure")
+			v.writeError(w, r, err)
+			return
+		}
+	}
 	log.WithFields(log.Fields{"id": id, "address": address[0], "non-voter": addNonVoter}).Info("Add member success")
 	w.WriteHeader(http.StatusOK)
 }
@@ -84,9 +244,290 @@ func (v *Veteran) DelMemberHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := v.core.DelMember(id); err != nil {
 		log.WithError(err).WithField("id", id).Error("Del member failure")
-		w.WriteHeader(http.StatusInternalServerError)
+		v.writeError(w, r, err)
 		return
 	}
 	log.WithField("id", id).Info("Del member success")
 	w.WriteHeader(http.StatusOK)
 }
+
+func (v *Veteran) SetPriorityHandler(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["memberID"]
+	priority := r.URL.Query().Get("value")
+
+	value, err := strconv.Atoi(priority)
+	if err != nil {
+		log.WithError(err).WithField("priority", priority).Error("Member priority is invalid")
+		writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Errorf("invalid priority %q", priority))
+		return
+	}
+
+	if err = v.core.SetPriority(id, value); err != nil {
+		log.WithError(err).WithFields(log.Fields{"id": id, "priority": value}).Error("Set member priority failure")
+		v.writeError(w, r, err)
+		return
+	}
+	log.WithFields(log.Fields{"id": id, "priority": value}).Info("Set member priority success")
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetMemberStateHandler 成员通过该接口向 leader 通告自己的健康状态以及 nopreempt 配置
+func (v *Veteran) SetMemberStateHandler(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["memberID"]
+	params := r.URL.Query()
+
+	// 未指定 healthy 时视为健康，避免误将成员降级
+	state := consensus.MemberState{Healthy: true}
+	for name, value := range map[string]*bool{"healthy": &state.Healthy, "nopreempt": &state.NoPreempt} {
+		if params.Get(name) == "" {
+			continue
+		}
+		parsed, err := strconv.ParseBool(params.Get(name))
+		if err != nil {
+			log.WithError(err).WithField(name, params.Get(name)).Error("Member state is invalid")
+			writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Errorf("invalid %s %q", name, params.Get(name)))
+			return
+		}
+		*value = parsed
+	}
+
+	fields := log.Fields{"id": id, "healthy": state.Healthy, "nopreempt": state.NoPreempt}
+	if err := v.core.SetMemberState(id, state); err != nil {
+		log.WithError(err).WithFields(fields).Error("Set member state failure")
+		v.writeError(w, r, err)
+		return
+	}
+	log.WithFields(fields).Info("Set member state success")
+	w.WriteHeader(http.StatusOK)
+}
+
+// TransferLeaderHandler 手动转移 leader，转移前暂停抢占，避免优先级抢占将 leader 转移回去。
+// hold 指定暂停时间，默认使用 preempt.transfer_hold，为 0 时不暂停
+func (v *Veteran) TransferLeaderHandler(w http.ResponseWriter, r *http.Request) {
+
+	id := r.URL.Query().Get("id")
+
+	hold := time.Duration(v.config.Preempt.TransferHold)
+	if hold <= 0 {
+		hold = defaultTransferHold
+	}
+	if value := r.URL.Query().Get("hold"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			log.WithError(err).WithField("hold", value).Error("Preempt hold is invalid")
+			writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Errorf("invalid hold %q", value))
+			return
+		}
+		hold = parsed
+	}
+
+	fields := log.Fields{"id": id, "hold": hold.String()}
+	if hold > 0 {
+		if err := v.core.HoldPreempt(hold); err != nil {
+			log.WithError(err).WithFields(fields).Error("Hold preemption failure")
+			v.writeError(w, r, err)
+			return
+		}
+	}
+
+	if err := v.core.TransferLeadership(id); err != nil {
+		log.WithError(err).WithFields(fields).Error("Transfer leadership failure")
+		// 转移失败时恢复抢占
+		if hold > 0 {
+			if rerr := v.core.ResumePreempt(); rerr != nil {
+				log.WithError(rerr).Warn("Resume preemption failure")
+			}
+		}
+		v.writeError(w, r, err)
+		return
+	}
+	log.WithFields(fields).Info("Transfer leadership success")
+	w.WriteHeader(http.StatusOK)
+}
+
+// ResumePreemptHandler 提前恢复手动转移 leader 后暂停的抢占
+func (v *Veteran) ResumePreemptHandler(w http.ResponseWriter, r *http.Request) {
+
+	if err := v.core.ResumePreempt(); err != nil {
+		log.WithError(err).Error("Resume preemption failure")
+		v.writeError(w, r, err)
+		return
+	}
+	log.Info("Resume preemption success")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (v *Veteran) GetKVHandler(w http.ResponseWriter, r *http.Request) {
+
+	key := mux.Vars(r)["key"]
+	consistent := strings.ToLower(r.URL.Query().Get("consistent")) == "true"
+
+	var (
+		value string
+		err   error
+	)
+	if consistent {
+		value, err = v.core.ConsistentGet(key)
+	} else {
+		value, err = v.core.Get(key)
+	}
+
+	if err != nil {
+		v.kvError(w, r, "Get", key, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, kvPair{Key: key, Value: value})
+}
+
+func (v *Veteran) PutKVHandler(w http.ResponseWriter, r *http.Request) {
+
+	key := mux.Vars(r)["key"]
+	params := r.URL.Query()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxValueSize+1))
+	if err != nil {
+		log.WithError(err).WithField("key", key).Error("Read value failure")
+		writeError(w, http.StatusBadRequest, codeBadRequest, err)
+		return
+	}
+	if len(body) > maxValueSize {
+		writeError(w, http.StatusRequestEntityTooLarge, codeValueTooLarge, fmt.Errorf("value is larger than %d bytes", maxValueSize))
+		return
+	}
+
+	// prev_value 存在时执行 cas，prev_exist=false 时要求 key 不存在
+	switch {
+	case params.Has("prev_value"):
+		prevValue := params.Get("prev_value")
+		err = v.core.CompareAndSwap(key, &prevValue, string(body))
+	case strings.ToLower(params.Get("prev_exist")) == "false":
+		err = v.core.CompareAndSwap(key, nil, string(body))
+	default:
+		err = v.core.Set(key, string(body))
+	}
+
+	if err != nil {
+		v.kvError(w, r, "Put", key, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (v *Veteran) DelKVHandler(w http.ResponseWriter, r *http.Request) {
+
+	key := mux.Vars(r)["key"]
+
+	if err := v.core.Delete(key); err != nil {
+		v.kvError(w, r, "Del", key, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// kvError 返回 kv 接口的错误，key 不存在、cas 失败、保留 key 以及需要重定向到 leader 的错误由调用方处理，不输出错误日志
+func (v *Veteran) kvError(w http.ResponseWriter, r *http.Request, operation, key string, err error) {
+
+	switch {
+	case errors.Is(err, consensus.ErrKeyNotFound),
+		errors.Is(err, consensus.ErrCompareFailed),
+		errors.Is(err, consensus.ErrReservedKey),
+		errors.Is(err, raft.ErrNotLeader):
+	default:
+		log.WithError(err).WithField("key", key).Errorf("%s key failure", operation)
+	}
+	v.writeError(w, r, err)
+}
+
+// redirectToLeader 将请求重定向到 leader 通告的 api 地址
+func (v *Veteran) redirectToLeader(w http.ResponseWriter, r *http.Request) {
+
+	leader, err := v.leaderHint()
+	if err != nil {
+		log.WithError(err).Error("Get leader failure")
+		writeError(w, http.StatusServiceUnavailable, codeNoLeader, err)
+		return
+	}
+
+	w.Header().Set("X-Veteran-Leader", leader.ID)
+	w.Header().Set("Location", leader.Address+r.URL.RequestURI())
+	writeJSON(w, http.StatusTemporaryRedirect, apiError{
+		Code:    codeNotLeader,
+		Message: raft.ErrNotLeader.Error(),
+		Leader:  leader,
+	})
+}
+
+// leaderHint 返回 leader 的 ID 以及 api 地址，leader 尚未通告 api 地址时使用 leader 的 raft 地址以及当前节点的 api 端口
+func (v *Veteran) leaderHint() (*leaderHint, error) {
+
+	id, address, err := v.core.LeaderAPI()
+	if err == nil {
+		return &leaderHint{ID: id, Address: address}, nil
+	}
+
+	hint, fallbackErr := v.raftLeaderHint()
+	if fallbackErr != nil {
+		return nil, err
+	}
+	return hint, nil
+}
+
+// raftLeaderHint 根据 leader 的 raft 地址生成 api 地址，leader 的 api 端口默认与当前节点一致
+func (v *Veteran) raftLeaderHint() (*leaderHint, error) {
+
+	state, err := v.core.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var leaderAddress string
+	for _, member := range state.Members {
+		if string(member.ID) == state.LeaderID {
+			leaderAddress = string(member.Address)
+		}
+	}
+
+	if leaderAddress == "" {
+		return nil, fmt.Errorf("leader is unknown")
+	}
+
+	leaderHost, _, err := net.SplitHostPort(leaderAddress)
+	if err != nil {
+		return nil, fmt.Errorf("parse leader address %s: %s", leaderAddress, err)
+	}
+
+	_, port, err := net.SplitHostPort(v.config.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("parse listen address %s: %s", v.config.Listen, err)
+	}
+
+	scheme := "http"
+	if v.config.APITLS.Enabled() {
+		scheme = "https"
+	}
+
+	return &leaderHint{ID: state.LeaderID, Address: fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(leaderHost, port))}, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+
+	body, err := json.Marshal(obj)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.WithError(err).Error("Marshal output failure")
+		return
+	}
+
+	var prettyJSON bytes.Buffer
+	if err = json.Indent(&prettyJSON, body, "", "    "); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.WithError(err).Error("Format output failure")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = fmt.Fprintf(w, "%v\n", prettyJSON.String())
+}
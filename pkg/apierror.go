@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"github.com/QQGoblin/veteran/pkg/consensus"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+const (
+	codeBadRequest      = "bad_request"
+	codeUnauthorized    = "unauthorized"
+	codeForbidden       = "forbidden"
+	codeNotLeader       = "not_leader"
+	codeNoLeader        = "no_leader"
+	codeKeyNotFound     = "key_not_found"
+	codeMemberNotFound  = "member_not_found"
+	codeAddressConflict = "address_conflict"
+	codeCompareFailed   = "compare_failed"
+	codeValueTooLarge   = "value_too_large"
+	codeForwardFailed   = "forward_failed"
+	codeInternal        = "internal_error"
+)
+
+// apiError 是接口失败时返回的内容，调用方可以根据 code 处理错误，不需要查看服务日志
+type apiError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Leader  *leaderHint `json:"leader,omitempty"` // 仅在请求需要发送到 leader 时返回
+}
+
+type leaderHint struct {
+	ID      string `json:"id"`
+	Address string `json:"address"` // leader 的 api 地址
+}
+
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	writeJSON(w, status, apiError{Code: code, Message: err.Error()})
+}
+
+// writeError 根据 consensus 返回的错误设置状态码，follower 上只能在 leader 执行的请求重定向到 leader
+func (v *Veteran) writeError(w http.ResponseWriter, r *http.Request, err error) {
+
+	switch {
+	case errors.Is(err, raft.ErrNotLeader):
+		v.redirectToLeader(w, r)
+	case errors.Is(err, consensus.ErrReservedKey), errors.Is(err, consensus.ErrAPIAddressRequired):
+		writeError(w, http.StatusBadRequest, codeBadRequest, err)
+	case errors.Is(err, consensus.ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, codeKeyNotFound, err)
+	case errors.Is(err, consensus.ErrMemberNotFound):
+		writeError(w, http.StatusNotFound, codeMemberNotFound, err)
+	case errors.Is(err, consensus.ErrAddressConflict):
+		writeError(w, http.StatusConflict, codeAddressConflict, err)
+	case errors.Is(err, consensus.ErrCompareFailed):
+		writeError(w, http.StatusPreconditionFailed, codeCompareFailed, err)
+	default:
+		writeError(w, http.StatusInternalServerError, codeInternal, err)
+	}
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// publicPaths 探测接口不需要认证，便于负载均衡以及编排系统直接访问
+var publicPaths = map[string]struct{}{
+	"/healthz": {},
+	"/readyz":  {},
+	"/leader":  {},
+}
+
+// authMiddleware 配置用户后校验客户端证书或 bearer token，readonly 用户只能调用 GET/HEAD 接口
+func (v *Veteran) authMiddleware(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if len(v.config.Auth.Users) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if _, ok := publicPaths[r.URL.Path]; ok && readOnly {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := v.authenticate(r)
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="veteran"`)
+			writeError(w, http.StatusUnauthorized, codeUnauthorized, fmt.Errorf("authentication required"))
+			return
+		}
+
+		if user.Role != config.RoleAdmin && !readOnly {
+			log.WithFields(log.Fields{"user": user.Name, "method": r.Method, "path": r.URL.Path}).Warn("Permission denied")
+			writeError(w, http.StatusForbidden, codeForbidden, fmt.Errorf("role %s is not allowed to %s %s", user.Role, r.Method, r.URL.Path))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate 优先使用 bearer token，其次使用已通过 CA 校验的客户端证书 CN
+func (v *Veteran) authenticate(r *http.Request) *config.UserConfig {
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for i, user := range v.config.Auth.Users {
+			if user.Token != "" && subtle.ConstantTimeCompare([]byte(user.Token), []byte(token)) == 1 {
+				return &v.config.Auth.Users[i]
+			}
+		}
+		return nil
+	}
+
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	for i, user := range v.config.Auth.Users {
+		if user.Name != "" && user.Name == name {
+			return &v.config.Auth.Users[i]
+		}
+	}
+	return nil
+}
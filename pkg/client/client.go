@@ -0,0 +1,294 @@
+package client
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/consensus"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoLeader = errors.New("no leader found")
+)
+
+// Client 调用 veteran 的 restful api，写请求会自动发送到 leader
+type Client struct {
+	endpoints []string
+	token     string
+	http      *http.Client
+}
+
+// Options 客户端选项，TLS 不为空时未指定协议的 endpoint 使用 https，Token 不为空时使用 bearer token 认证
+type Options struct {
+	Timeout time.Duration
+	TLS     *tls.Config
+	Token   string
+}
+
+type kvPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// StatusError 表示 api 返回了非 2xx 状态码，Reason 以及 Message 来自 api 返回的错误内容
+type StatusError struct {
+	Code    int
+	Reason  string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status %d %s", e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("unexpected status %d %s: %s", e.Code, http.StatusText(e.Code), e.Message)
+}
+
+// New 创建客户端，endpoints 为 api 地址列表，未指定协议时默认使用 http，配置 TLS 时默认使用 https
+func New(endpoints []string, options Options) (*Client, error) {
+
+	c := &Client{
+		token: options.Token,
+		http:  &http.Client{Timeout: options.Timeout},
+	}
+
+	scheme := "http://"
+	if options.TLS != nil {
+		scheme = "https://"
+		c.http.Transport = &http.Transport{TLSClientConfig: options.TLS}
+	}
+
+	for _, endpoint := range endpoints {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		if !strings.Contains(endpoint, "://") {
+			endpoint = scheme + endpoint
+		}
+		c.endpoints = append(c.endpoints, strings.TrimRight(endpoint, "/"))
+	}
+
+	if len(c.endpoints) == 0 {
+		return nil, fmt.Errorf("endpoints is empty")
+	}
+
+	return c, nil
+}
+
+// Leader 依次探测 endpoints 的 /leader 接口，返回当前 leader 的 api 地址
+func (c *Client) Leader() (string, error) {
+
+	for _, endpoint := range c.endpoints {
+		resp, err := c.send(http.MethodGet, endpoint+"/leader", nil)
+		if err != nil {
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return endpoint, nil
+		}
+	}
+
+	return "", ErrNoLeader
+}
+
+func (c *Client) Status() (*consensus.ClusterState, error) {
+
+	state := &consensus.ClusterState{}
+	if err := c.any(http.MethodGet, "/status", state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// AddMember 添加成员，apiAddress 为成员通告的 api 地址，priority 为空时不设置优先级
+func (c *Client) AddMember(id, address, apiAddress string, nonVoter bool, priority *int) error {
+
+	params := url.Values{}
+	params.Set("address", address)
+	if apiAddress != "" {
+		params.Set("api_address", apiAddress)
+	}
+	if nonVoter {
+		params.Set("non_voter", "true")
+	}
+	if priority != nil {
+		params.Set("priority", strconv.Itoa(*priority))
+	}
+
+	return c.leader(http.MethodPost, "/member/"+url.PathEscape(id)+"?"+params.Encode(), nil, nil)
+}
+
+func (c *Client) DelMember(id string) error {
+	return c.leader(http.MethodDelete, "/member/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *Client) SetPriority(id string, priority int) error {
+	return c.leader(http.MethodPut, "/member/"+url.PathEscape(id)+"/priority?value="+strconv.Itoa(priority), nil, nil)
+}
+
+// SetMemberState 向 leader 通告成员状态
+func (c *Client) SetMemberState(id string, state consensus.MemberState) error {
+
+	params := url.Values{}
+	params.Set("healthy", strconv.FormatBool(state.Healthy))
+	params.Set("nopreempt", strconv.FormatBool(state.NoPreempt))
+
+	return c.leader(http.MethodPut, "/member/"+url.PathEscape(id)+"/state?"+params.Encode(), nil, nil)
+}
+
+// TransferLeader 转移 leader，id 为空时由 raft 选择目标成员，hold 为空时使用服务端配置的抢占暂停时间
+func (c *Client) TransferLeader(id string, hold *time.Duration) error {
+
+	params := url.Values{}
+	if id != "" {
+		params.Set("id", id)
+	}
+	if hold != nil {
+		params.Set("hold", hold.String())
+	}
+
+	path := "/leader/transfer"
+	if len(params) != 0 {
+		path += "?" + params.Encode()
+	}
+	return c.leader(http.MethodPost, path, nil, nil)
+}
+
+// ResumePreempt 提前恢复手动转移 leader 后暂停的抢占
+func (c *Client) ResumePreempt() error {
+	return c.leader(http.MethodDelete, "/preempt/hold", nil, nil)
+}
+
+// Get 读取 key，consistent 为 true 时从 leader 读取最新数据
+func (c *Client) Get(key string, consistent bool) (string, error) {
+
+	var (
+		pair kvPair
+		err  error
+	)
+
+	if consistent {
+		err = c.leader(http.MethodGet, kvPath(key)+"?consistent=true", nil, &pair)
+	} else {
+		err = c.any(http.MethodGet, kvPath(key), &pair)
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return "", consensus.ErrKeyNotFound
+	}
+	return pair.Value, err
+}
+
+// Put 写入 key，prevValue 不为空时执行 cas，prevExist 为 false 时要求 key 不存在
+func (c *Client) Put(key, value string, prevValue *string, prevExist bool) error {
+
+	params := url.Values{}
+	if prevValue != nil {
+		params.Set("prev_value", *prevValue)
+	} else if !prevExist {
+		params.Set("prev_exist", "false")
+	}
+
+	path := kvPath(key)
+	if len(params) != 0 {
+		path += "?" + params.Encode()
+	}
+
+	err := c.leader(http.MethodPut, path, strings.NewReader(value), nil)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusPreconditionFailed {
+		return consensus.ErrCompareFailed
+	}
+	return err
+}
+
+func (c *Client) Delete(key string) error {
+	return c.leader(http.MethodDelete, kvPath(key), nil, nil)
+}
+
+// kvPath 分别转义 key 中以 / 分隔的每一段，保留 / 作为路径分隔符
+func kvPath(key string) string {
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/kv/" + strings.Join(segments, "/")
+}
+
+// any 依次尝试所有 endpoints，直到请求成功或返回非网络错误
+func (c *Client) any(method, path string, out interface{}) error {
+
+	var err error
+	for _, endpoint := range c.endpoints {
+		err = c.do(method, endpoint+path, nil, out)
+		var statusErr *StatusError
+		if err == nil || errors.As(err, &statusErr) {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *Client) leader(method, path string, body io.Reader, out interface{}) error {
+
+	endpoint, err := c.Leader()
+	if err != nil {
+		return err
+	}
+	return c.do(method, endpoint+path, body, out)
+}
+
+func (c *Client) do(method, target string, body io.Reader, out interface{}) error {
+
+	resp, err := c.send(method, target, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		statusErr := &StatusError{}
+		if json.Unmarshal(data, statusErr) != nil {
+			statusErr.Message = strings.TrimSpace(string(data))
+		}
+		statusErr.Code = resp.StatusCode
+		return statusErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	return errors.Wrapf(json.Unmarshal(data, out), "decode response from %s", target)
+}
+
+func (c *Client) send(method, target string, body io.Reader) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	return c.http.Do(req)
+}
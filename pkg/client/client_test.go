@@ -0,0 +1,56 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestKVPath(t *testing.T) {
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "owner", want: "/kv/owner"},
+		{key: "a/b/c", want: "/kv/a/b/c"},
+		{key: "a b", want: "/kv/a%20b"},
+		{key: "a?b#c", want: "/kv/a%3Fb%23c"},
+		{key: "100%", want: "/kv/100%25"},
+	}
+
+	for _, tt := range tests {
+		if got := kvPath(tt.key); got != tt.want {
+			t.Errorf("kvPath(%q): expected %q, got %q", tt.key, tt.want, got)
+		}
+	}
+}
+
+// TestGetEscapesKey 验证特殊字符的 key 经过 api 路由后与原始 key 一致
+func TestGetEscapesKey(t *testing.T) {
+
+	r := mux.NewRouter()
+	r.Methods(http.MethodGet).Path("/kv/{key:.+}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(kvPair{Key: mux.Vars(r)["key"], Value: mux.Vars(r)["key"]})
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	c, err := New([]string{srv.URL}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a/b", "a b?c=d#e", "100%", "中文"} {
+		value, err := c.Get(key, false)
+		if err != nil {
+			t.Fatalf("get %q: %s", key, err)
+		}
+		if value != key {
+			t.Fatalf("expected key %q, got %q", key, value)
+		}
+	}
+}
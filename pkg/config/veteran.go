@@ -2,19 +2,45 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"os"
+	"strings"
+	"time"
 )
 
 const (
 	defaultRaftLogName = "/var/log/veteran/raft.log"
 )
 
+const (
+	RoleAdmin    = "admin"
+	RoleReadOnly = "readonly"
+)
+
 type VeteranConfig struct {
 	ID        string            `json:"id"`
 	Listen    string            `json:"listen"`
+	Advertise string            `json:"advertise_api"` // 其他成员访问当前节点 api 的地址，例如 https://172.28.117.41:27000，默认根据 listen 生成
 	Store     string            `json:"store"`
+	LogLevel  string            `json:"log_level"`
 	InitPeers map[string]string `json:"initial_cluster"`
+	Join      []string          `json:"join"` // 已有集群的 api 地址，首次启动时不初始化集群而是请求 leader 添加当前节点
+
+	// MemberToken 成员之间调用 api 使用的 bearer token，用于加入集群、向 leader 通告健康状态以及 autopilot 读取成员的 /status，
+	// 开启 auth 并且没有配置 api_tls 客户端证书时必须配置 admin 角色的 token
+	MemberToken string `json:"member_token"`
+	JoinToken   string `json:"join_token"` // 已废弃，member_token 为空时使用
+
 	RaftLog   RaftLogConfig     `json:"raft_log"`
+	Snapshot  SnapshotConfig    `json:"snapshot"`
+	Health    HealthCheckConfig `json:"health_check"`
+	Preempt   PreemptConfig     `json:"preempt"`
+	Autopilot AutopilotConfig   `json:"autopilot"`
+	Reaper    ReaperConfig      `json:"dead_server_cleanup"`
+	RaftTLS   TLSConfig         `json:"raft_tls"`
+	APITLS    APITLSConfig      `json:"api_tls"`
+	Auth      AuthConfig        `json:"auth"`
 	Raw       []byte
 }
 
@@ -24,6 +50,127 @@ type RaftLogConfig struct {
 	Level  string `json:"level"`
 }
 
+type SnapshotConfig struct {
+	Threshold uint64   `json:"threshold"` // 两次快照之间至少间隔的日志条数，0 表示使用 raft 默认值
+	Interval  Duration `json:"interval"`  // 检查是否需要快照的间隔，0 表示使用 raft 默认值
+}
+
+// PreemptConfig 参考 VRRP priority/nopreempt，leader 会将 leader 转移给健康且优先级更高的成员
+type PreemptConfig struct {
+	Priority  int      `json:"priority"`  // 当前节点的优先级，默认 0
+	NoPreempt bool     `json:"nopreempt"` // 为 true 时当前节点优先级更高也不会抢占其他成员的 leader
+	Delay     Duration `json:"delay"`     // 优先级更高的成员需要稳定多久才会转移 leader，默认 30s
+	// TransferHold 通过 api 手动转移 leader 后暂停抢占的时间，默认 1h，可以通过 DELETE /preempt/hold 提前恢复
+	TransferHold Duration `json:"transfer_hold"`
+}
+
+// AutopilotConfig 开启后 leader 先以 non-voter 身份添加新成员，日志追上并稳定后再提升为 voter
+type AutopilotConfig struct {
+	Enable     bool     `json:"enable"`
+	MaxLag     uint64   `json:"max_lag"`     // 成员落后 leader 的日志条数不超过该值时视为已追上，默认 250
+	StableTime Duration `json:"stable_time"` // 成员需要持续追上多久才会提升为 voter，默认 10s
+}
+
+// ReaperConfig 开启后 leader 会删除心跳持续失败超过 Threshold 的成员
+type ReaperConfig struct {
+	Enable    bool     `json:"enable"`
+	Threshold Duration `json:"threshold"`  // 成员心跳持续失败多久后删除，默认 1h
+	MinQuorum *int     `json:"min_quorum"` // 删除后 voter 数量不能少于该值，默认 3，不能小于 1
+}
+
+// TLSConfig 证书以及用于校验对端证书的 CA，均为 PEM 格式文件路径
+type TLSConfig struct {
+	CA   string `json:"ca"`
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CA != "" || c.Cert != "" || c.Key != ""
+}
+
+// APITLSConfig api 使用 https，配置 CA 时校验客户端证书
+type APITLSConfig struct {
+	TLSConfig
+	RequireClientCert bool `json:"require_client_cert"` // 为 true 时拒绝没有客户端证书的连接
+}
+
+// AuthConfig 配置用户后，除探测接口外的所有 api 请求都需要通过客户端证书或 bearer token 认证
+type AuthConfig struct {
+	Users []UserConfig `json:"users"`
+}
+
+type UserConfig struct {
+	Name  string `json:"name"`  // 客户端证书的 CN
+	Token string `json:"token"` // bearer token
+	Role  string `json:"role"`  // admin 可以调用所有接口，readonly 只能调用 GET/HEAD 接口
+}
+
+type HealthCheckConfig struct {
+	Interval Duration `json:"interval"` // 检查间隔，默认 5s
+	Timeout  Duration `json:"timeout"`  // 单次检查超时时间，默认 3s
+	Fall     int      `json:"fall"`     // 连续失败多少次后标记为不健康，默认 3
+	Rise     int      `json:"rise"`     // 连续成功多少次后恢复健康，默认 2
+	// MinVoters 不健康的成员会被降级为 non-voter，降级后 voter 数量不能少于 min_voters，默认 3
+	MinVoters int           `json:"min_voters"`
+	Checks    []CheckConfig `json:"checks"`
+}
+
+type CheckConfig struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`   // tcp、http 或 exec
+	Target string   `json:"target"` // tcp 为 host:port，http 为 url，exec 为脚本路径
+	Args   []string `json:"args"`   // 仅用于 exec
+}
+
+// Duration 支持在配置文件中使用 "10s"、"1m" 格式的时间
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %s", err)
+	}
+
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(value)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// APIAddress 返回当前节点对外通告的 api 地址，listen 为 0.0.0.0 等地址时使用 raft 地址的 host
+func (c *VeteranConfig) APIAddress() string {
+
+	if c.Advertise != "" {
+		return strings.TrimRight(c.Advertise, "/")
+	}
+
+	host, port, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return ""
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		if host, _, err = net.SplitHostPort(c.InitPeers[c.ID]); err != nil {
+			return ""
+		}
+	}
+
+	scheme := "http"
+	if c.APITLS.Enabled() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+}
+
 func LoadConfig(filepath string) (*VeteranConfig, error) {
 
 	b, err := os.ReadFile(filepath)
@@ -32,6 +179,7 @@ func LoadConfig(filepath string) (*VeteranConfig, error) {
 	}
 
 	c := &VeteranConfig{
+		LogLevel: "info",
 		RaftLog: RaftLogConfig{
 			Output: defaultRaftLogName,
 			Enable: false,
@@ -48,5 +196,23 @@ func LoadConfig(filepath string) (*VeteranConfig, error) {
 		c.ID, _ = os.Hostname()
 	}
 
+	// 兼容使用 join_token 的旧配置
+	if c.MemberToken == "" {
+		c.MemberToken = c.JoinToken
+	}
+
+	if c.Reaper.MinQuorum != nil && *c.Reaper.MinQuorum < 1 {
+		return nil, fmt.Errorf("dead_server_cleanup min_quorum must be at least 1, got %d", *c.Reaper.MinQuorum)
+	}
+
+	for _, user := range c.Auth.Users {
+		if user.Role != RoleAdmin && user.Role != RoleReadOnly {
+			return nil, fmt.Errorf("user %s has invalid role %q", user.Name, user.Role)
+		}
+		if user.Name == "" && user.Token == "" {
+			return nil, fmt.Errorf("user must have a name or a token")
+		}
+	}
+
 	return c, nil
 }
@@ -0,0 +1,86 @@
+package consensus
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyPrefix      = internalKeyPrefix + "api/"
+	advertiseInterval = time.Second
+)
+
+// SetAPIAddress 记录成员的 api 地址，follower 根据 leader 的 api 地址转发写请求
+func (m *Manager) SetAPIAddress(memberID, address string) error {
+
+	if err := m.leaderCheck(); err != nil {
+		return err
+	}
+
+	return m.setInternal(apiKeyPrefix+memberID, address)
+}
+
+// APIAddresses 返回集群中记录的所有成员 api 地址
+func (m *Manager) APIAddresses() map[string]string {
+
+	addresses := make(map[string]string)
+	for key, value := range m.fsm.List(apiKeyPrefix) {
+		addresses[strings.TrimPrefix(key, apiKeyPrefix)] = value
+	}
+	return addresses
+}
+
+// LeaderAPI 返回 leader 的 ID 以及 api 地址
+func (m *Manager) LeaderAPI() (string, string, error) {
+
+	if m.Raft == nil {
+		return "", "", fmt.Errorf("raft is not init")
+	}
+
+	_, leaderID := m.Raft.LeaderWithID()
+	if leaderID == "" {
+		return "", "", fmt.Errorf("leader is unknown")
+	}
+
+	address, ok := m.fsm.Get(apiKeyPrefix + string(leaderID))
+	if !ok {
+		return "", "", fmt.Errorf("api address of leader %s is unknown", leaderID)
+	}
+
+	return string(leaderID), address, nil
+}
+
+// runAdvertise 在 leader 上写入当前节点的 api 地址，成为 leader 后尽快通告，便于 follower 转发请求
+func (m *Manager) runAdvertise() {
+
+	if m.advertise == "" {
+		log.Warn("Api address is unknown, followers can not forward requests to this node")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(advertiseInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.stopCh:
+				return
+			}
+
+			if !m.IsLeader() {
+				continue
+			}
+
+			if current, ok := m.fsm.Get(apiKeyPrefix + m.id); ok && current == m.advertise {
+				continue
+			}
+			if err := m.setInternal(apiKeyPrefix+m.id, m.advertise); err != nil {
+				log.WithError(err).Warn("Publish api address failure")
+			}
+		}
+	}()
+}
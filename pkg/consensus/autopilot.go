@@ -0,0 +1,214 @@
+package consensus
+
+import (
+	"fmt"
+	"github.com/hashicorp/raft"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const (
+	// stagingKeyPrefix 记录等待 autopilot 提升为 voter 的成员，显式以 non-voter 添加的成员不会写入
+	stagingKeyPrefix         = internalKeyPrefix + "staging/"
+	defaultAutopilotMaxLag   = 250
+	defaultAutopilotStable   = 10 * time.Second
+	autopilotInterval        = 2 * time.Second
+	autopilotContactDeadline = 5 * time.Second
+)
+
+// ProgressReader 读取成员的最新日志索引，由调用方通过成员通告的 api 地址实现
+type ProgressReader interface {
+	LastIndex(memberID, apiAddress string) (uint64, error)
+}
+
+// SetProgressReader 设置 autopilot 读取 non-voter 复制进度的方式，需要在 InitRaft 之前调用
+func (m *Manager) SetProgressReader(reader ProgressReader) {
+	m.progress = reader
+}
+
+// runAutopilot 在 leader 上周期检查 non-voter 的复制进度，追上 leader 并稳定一段时间后提升为 voter
+func (m *Manager) runAutopilot() {
+
+	if !m.autopilot.Enable {
+		return
+	}
+
+	maxLag := m.autopilot.MaxLag
+	if maxLag == 0 {
+		maxLag = defaultAutopilotMaxLag
+	}
+
+	stable := time.Duration(m.autopilot.StableTime)
+	if stable <= 0 {
+		stable = defaultAutopilotStable
+	}
+
+	go func() {
+		ticker := time.NewTicker(autopilotInterval)
+		defer ticker.Stop()
+
+		// caughtUp 记录成员从什么时候开始持续追上 leader，只在当前节点是 leader 期间有效
+		caughtUp := make(map[raft.ServerID]time.Time)
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.stopCh:
+				return
+			}
+
+			if !m.IsLeader() {
+				caughtUp = make(map[raft.ServerID]time.Time)
+				m.setStaging(nil)
+				continue
+			}
+
+			if err := m.autopilotCheck(caughtUp, maxLag, stable); err != nil {
+				log.WithError(err).Error("Autopilot check failure")
+			}
+		}
+	}()
+}
+
+func (m *Manager) autopilotCheck(caughtUp map[raft.ServerID]time.Time, maxLag uint64, stable time.Duration) error {
+
+	future := m.Raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+
+	servers := make(map[raft.ServerID]raft.Server)
+	for _, server := range future.Configuration().Servers {
+		servers[server.ID] = server
+	}
+
+	lastIndex := m.Raft.LastIndex()
+
+	// reasons 记录成员尚未被提升的原因，通过 /status 返回，便于排查一直没有被提升的成员
+	previous := m.Staging()
+	reasons := make(map[string]string)
+	defer func() { m.setStaging(reasons) }()
+
+	for key := range m.fsm.List(stagingKeyPrefix) {
+		id := raft.ServerID(strings.TrimPrefix(key, stagingKeyPrefix))
+
+		server, ok := servers[id]
+		if !ok || server.Suffrage == raft.Voter {
+			// 成员已被删除或已经是 voter
+			delete(caughtUp, id)
+			if err := m.deleteInternal(key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// 不健康的成员提升为 voter 后会被降级，等待恢复健康后再提升
+		state := m.peers.get(id)
+		switch {
+		case !m.Healthy(string(id)):
+			reasons[string(id)] = "unhealthy"
+		case state.Failed || time.Since(state.LastContact) > autopilotContactDeadline:
+			reasons[string(id)] = "not contacted by leader"
+		}
+		if _, stuck := reasons[string(id)]; stuck {
+			delete(caughtUp, id)
+			continue
+		}
+
+		lag, err := m.replicationLag(id, lastIndex)
+		if err != nil {
+			reason := fmt.Sprintf("read replication progress: %s", err)
+			// 同一个错误只在第一次出现时输出警告
+			entry := log.WithError(err).WithField("id", id)
+			if previous[string(id)] != reason {
+				entry.Warn("Autopilot read replication progress failure, member will not be promoted")
+			} else {
+				entry.Debug("Autopilot read replication progress failure")
+			}
+			reasons[string(id)] = reason
+			delete(caughtUp, id)
+			continue
+		}
+		if lag > maxLag {
+			reasons[string(id)] = fmt.Sprintf("lagging %d entries behind leader", lag)
+			delete(caughtUp, id)
+			continue
+		}
+
+		since, ok := caughtUp[id]
+		if !ok {
+			caughtUp[id] = time.Now()
+			since = caughtUp[id]
+		}
+		if time.Since(since) < stable {
+			reasons[string(id)] = fmt.Sprintf("caught up since %s, waiting for stable time", since.Format(time.RFC3339))
+			continue
+		}
+
+		log.WithFields(log.Fields{"id": id, "address": server.Address, "lag": lag}).Info("Autopilot promote non-voter to voter")
+		if err := m.promote(server); err != nil {
+			reasons[string(id)] = fmt.Sprintf("promote: %s", err)
+			return err
+		}
+		delete(caughtUp, id)
+		if err := m.deleteInternal(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Staging 返回等待 autopilot 提升为 voter 的成员以及尚未提升的原因，原因只在 leader 上记录
+func (m *Manager) Staging() map[string]string {
+
+	m.stagingLock.Lock()
+	defer m.stagingLock.Unlock()
+
+	staging := make(map[string]string)
+	for key := range m.fsm.List(stagingKeyPrefix) {
+		id := strings.TrimPrefix(key, stagingKeyPrefix)
+		staging[id] = "pending"
+		if reason, ok := m.staging[id]; ok {
+			staging[id] = reason
+		}
+	}
+	return staging
+}
+
+func (m *Manager) setStaging(reasons map[string]string) {
+	m.stagingLock.Lock()
+	defer m.stagingLock.Unlock()
+	m.staging = reasons
+}
+
+// replicationLag 通过成员的 api 读取其最新日志索引，计算落后 leader 的日志条数
+func (m *Manager) replicationLag(id raft.ServerID, lastIndex uint64) (uint64, error) {
+
+	if m.progress == nil {
+		return 0, fmt.Errorf("progress reader is not set")
+	}
+
+	address, ok := m.fsm.Get(apiKeyPrefix + string(id))
+	if !ok {
+		return 0, fmt.Errorf("api address of %s is unknown", id)
+	}
+
+	index, err := m.progress.LastIndex(string(id), address)
+	if err != nil {
+		return 0, err
+	}
+	if index == 0 {
+		return 0, fmt.Errorf("%s has no log", id)
+	}
+	return lastIndex - min(index, lastIndex), nil
+}
+
+func (m *Manager) promote(server raft.Server) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.Raft.AddVoter(server.ID, server.Address, 0, memberOperTimeout).Error()
+}
@@ -0,0 +1,55 @@
+package consensus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// TestAutopilotStaging 检查开启 autopilot 时拒绝没有 api 地址的成员，并通过 Status 返回成员尚未被提升的原因
+func TestAutopilotStaging(t *testing.T) {
+
+	managers := newTestManagers("n1", "n2", "n3")
+	for _, m := range managers {
+		m.autopilot.Enable = true
+	}
+	startTestCluster(t, managers)
+
+	leader := waitLeader(t, managers)
+
+	if err := leader.AddMember("n4", "n4", "", false); !errors.Is(err, ErrAPIAddressRequired) {
+		t.Fatalf("expected %v, got %v", ErrAPIAddressRequired, err)
+	}
+	if _, ok := leader.fsm.Get(stagingKeyPrefix + "n4"); ok {
+		t.Fatal("expected rejected member not to be staged")
+	}
+
+	// n4 不需要真的启动，leader 联系不到 n4 时不会提升
+	if err := leader.AddMember("n4", "n4", "http://n4:27000", false); err != nil {
+		t.Fatal(err)
+	}
+	if address := leader.APIAddresses()["n4"]; address != "http://n4:27000" {
+		t.Fatalf("expected api address of n4 to be recorded, got %q", address)
+	}
+
+	state, err := leader.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason := state.Staging["n4"]; reason != "pending" {
+		t.Fatalf("expected n4 to be pending, got %q", reason)
+	}
+
+	if err = leader.autopilotCheck(make(map[raft.ServerID]time.Time), defaultAutopilotMaxLag, defaultAutopilotStable); err != nil {
+		t.Fatal(err)
+	}
+	if state, err = leader.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if reason := state.Staging["n4"]; !strings.Contains(reason, "not contacted") {
+		t.Fatalf("expected n4 not to be contacted, got %q", reason)
+	}
+}
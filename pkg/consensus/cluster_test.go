@@ -0,0 +1,89 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+// newTestManagers 创建没有启动 raft 的成员，调用 startTestCluster 前可以修改成员的配置
+func newTestManagers(ids ...string) []*Manager {
+
+	managers := make([]*Manager, 0, len(ids))
+	for _, id := range ids {
+		managers = append(managers, &Manager{
+			id:     id,
+			fsm:    NewFSM(),
+			stopCh: make(chan struct{}),
+			peers:  newPeerTracker(),
+			known:  make(map[raft.ServerID]raft.ServerAddress),
+		})
+	}
+	return managers
+}
+
+// startTestCluster 使用内存 transport 以及存储启动 raft 集群，测试结束时关闭
+func startTestCluster(t *testing.T, managers []*Manager) {
+	t.Helper()
+
+	transports := make([]*raft.InmemTransport, 0, len(managers))
+	configuration := raft.Configuration{}
+	for _, m := range managers {
+		_, transport := raft.NewInmemTransport(raft.ServerAddress(m.id))
+		transports = append(transports, transport)
+		configuration.Servers = append(configuration.Servers, raft.Server{ID: raft.ServerID(m.id), Address: transport.LocalAddr()})
+	}
+	for _, a := range transports {
+		for _, b := range transports {
+			a.Connect(b.LocalAddr(), b)
+		}
+	}
+
+	for i, m := range managers {
+		config := raft.DefaultConfig()
+		config.LocalID = raft.ServerID(m.id)
+		config.HeartbeatTimeout = 50 * time.Millisecond
+		config.ElectionTimeout = 50 * time.Millisecond
+		config.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.CommitTimeout = 5 * time.Millisecond
+		config.Logger = hclog.NewNullLogger()
+
+		store := raft.NewInmemStore()
+		snapshots := raft.NewInmemSnapshotStore()
+		if err := raft.BootstrapCluster(config, store, store, snapshots, transports[i], configuration); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := raft.NewRaft(config, m.fsm, store, store, snapshots, transports[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Raft = r
+	}
+
+	t.Cleanup(func() {
+		for _, m := range managers {
+			close(m.stopCh)
+			_ = m.Raft.Shutdown().Error()
+		}
+	})
+}
+
+// waitLeader 等待集群选出 leader 并返回 leader 对应的成员
+func waitLeader(t *testing.T, managers []*Manager) *Manager {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, m := range managers {
+			if m.IsLeader() {
+				return m
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("leader is not elected")
+	return nil
+}
@@ -1,23 +1,185 @@
 package consensus
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
+	"sync"
 
+	"github.com/QQGoblin/veteran/pkg/membership"
 	"github.com/hashicorp/raft"
 )
 
-type FSM struct{}
+const (
+	snapshotVersion = 1
+)
+
+const (
+	opSet    = "set"
+	opDelete = "delete"
+	opCAS    = "cas"
+)
+
+var (
+	ErrKeyNotFound   = errors.New("key not found")
+	ErrCompareFailed = errors.New("compare failed")
+)
+
+// command 是写入 raft 日志的 KV 操作
+type command struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// PrevValue 仅用于 cas，为空时要求 key 不存在
+	PrevValue *string `json:"prev_value,omitempty"`
+}
+
+// FSM 是一个简单的 KV 状态机，用于在集群中保存少量共享状态
+type FSM struct {
+	lock sync.RWMutex
+	data map[string]string
+	// members 根据配置日志计算成员变化，所有成员都会应用配置日志，follower 也能收到成员变化
+	members      membership.Tracker
+	onMembership func([]membership.Change)
+}
+
+type FSMSnapshot struct {
+	data map[string]string
+}
+
+// snapshotData 是快照文件的格式，修改格式时需要增加 Version 并兼容旧版本
+type snapshotData struct {
+	Version int               `json:"version"`
+	Data    map[string]string `json:"data"`
+}
+
+func NewFSM() *FSM {
+	return &FSM{data: make(map[string]string)}
+}
+
+func (fsm *FSM) Apply(l *raft.Log) interface{} {
+
+	if l.Type != raft.LogCommand {
+		return nil
+	}
+
+	var c command
+	if err := json.Unmarshal(l.Data, &c); err != nil {
+		return fmt.Errorf("decode command: %s", err)
+	}
+
+	fsm.lock.Lock()
+	defer fsm.lock.Unlock()
+
+	switch c.Op {
+	case opSet:
+		fsm.data[c.Key] = c.Value
+	case opDelete:
+		delete(fsm.data, c.Key)
+	case opCAS:
+		current, ok := fsm.data[c.Key]
+		if c.PrevValue == nil && ok {
+			return ErrCompareFailed
+		}
+		if c.PrevValue != nil && (!ok || current != *c.PrevValue) {
+			return ErrCompareFailed
+		}
+		fsm.data[c.Key] = c.Value
+	default:
+		return fmt.Errorf("unknown command %q", c.Op)
+	}
+
+	return nil
+}
+
+func (fsm *FSM) Get(key string) (string, bool) {
+	fsm.lock.RLock()
+	defer fsm.lock.RUnlock()
+
+	value, ok := fsm.data[key]
+	return value, ok
+}
+
+// List 返回所有以 prefix 开头的 key
+func (fsm *FSM) List(prefix string) map[string]string {
+	fsm.lock.RLock()
+	defer fsm.lock.RUnlock()
+
+	result := make(map[string]string)
+	for k, v := range fsm.data {
+		if strings.HasPrefix(k, prefix) {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// Restore 从快照恢复状态。升级前的版本生成的快照内容为空（版本为 0），按空状态处理
+func (fsm *FSM) Restore(reader io.ReadCloser) error {
+	defer reader.Close()
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("read snapshot: %s", err)
+	}
+
+	var snapshot snapshotData
+	if len(bytes.TrimSpace(body)) != 0 {
+		if err = json.Unmarshal(body, &snapshot); err != nil {
+			return fmt.Errorf("decode snapshot: %s", err)
+		}
+	}
+
+	switch snapshot.Version {
+	case 0:
+		snapshot.Data = nil
+	case snapshotVersion:
+	default:
+		return fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	if snapshot.Data == nil {
+		snapshot.Data = make(map[string]string)
+	}
+
+	fsm.lock.Lock()
+	fsm.data = snapshot.Data
+	fsm.lock.Unlock()
+
+	return nil
+}
+
+func (fsm *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	fsm.lock.RLock()
+	defer fsm.lock.RUnlock()
 
-type FSMSnapshot struct{}
+	data := make(map[string]string, len(fsm.data))
+	for k, v := range fsm.data {
+		data[k] = v
+	}
+	return &FSMSnapshot{data: data}, nil
+}
 
-func (fsm FSM) Apply(*raft.Log) interface{} { return nil }
+// StoreConfiguration 在配置日志提交后由 raft 调用
+func (fsm *FSM) StoreConfiguration(index uint64, configuration raft.Configuration) {
 
-func (fsm FSM) Restore(io.ReadCloser) error { return nil }
+	changes := fsm.members.Store(index, configuration.Servers)
+	if len(changes) != 0 && fsm.onMembership != nil {
+		fsm.onMembership(changes)
+	}
+}
 
-func (fsm FSM) Snapshot() (raft.FSMSnapshot, error) { return FSMSnapshot{}, nil }
+func (snapshot *FSMSnapshot) Persist(sink raft.SnapshotSink) error {
 
-func (fsm FSM) StoreConfiguration(uint64, raft.Configuration) {}
+	if err := json.NewEncoder(sink).Encode(snapshotData{Version: snapshotVersion, Data: snapshot.data}); err != nil {
+		_ = sink.Cancel()
+		return fmt.Errorf("encode snapshot: %s", err)
+	}
 
-func (snapshot FSMSnapshot) Persist(raft.SnapshotSink) error { return nil }
+	return sink.Close()
+}
 
-func (snapshot FSMSnapshot) Release() {}
+func (snapshot *FSMSnapshot) Release() {}
@@ -0,0 +1,222 @@
+package consensus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+// memorySink 将快照写入内存，用于测试 Persist
+type memorySink struct {
+	bytes.Buffer
+	canceled bool
+}
+
+func (s *memorySink) ID() string    { return "test" }
+func (s *memorySink) Cancel() error { s.canceled = true; return nil }
+func (s *memorySink) Close() error  { return nil }
+
+func commandLog(t *testing.T, c command) *raft.Log {
+	t.Helper()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &raft.Log{Type: raft.LogCommand, Data: data}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestFSMApply(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		data    map[string]string
+		cmd     command
+		wantErr error
+		want    map[string]string
+	}{
+		{
+			name: "set new key",
+			data: map[string]string{},
+			cmd:  command{Op: opSet, Key: "a", Value: "1"},
+			want: map[string]string{"a": "1"},
+		},
+		{
+			name: "set overwrites existing key",
+			data: map[string]string{"a": "1"},
+			cmd:  command{Op: opSet, Key: "a", Value: "2"},
+			want: map[string]string{"a": "2"},
+		},
+		{
+			name: "delete existing key",
+			data: map[string]string{"a": "1", "b": "2"},
+			cmd:  command{Op: opDelete, Key: "a"},
+			want: map[string]string{"b": "2"},
+		},
+		{
+			name: "delete missing key",
+			data: map[string]string{"b": "2"},
+			cmd:  command{Op: opDelete, Key: "a"},
+			want: map[string]string{"b": "2"},
+		},
+		{
+			name: "cas hit",
+			data: map[string]string{"a": "1"},
+			cmd:  command{Op: opCAS, Key: "a", Value: "2", PrevValue: stringPtr("1")},
+			want: map[string]string{"a": "2"},
+		},
+		{
+			name:    "cas miss on different value",
+			data:    map[string]string{"a": "1"},
+			cmd:     command{Op: opCAS, Key: "a", Value: "2", PrevValue: stringPtr("3")},
+			wantErr: ErrCompareFailed,
+			want:    map[string]string{"a": "1"},
+		},
+		{
+			name:    "cas miss on missing key",
+			data:    map[string]string{},
+			cmd:     command{Op: opCAS, Key: "a", Value: "2", PrevValue: stringPtr("1")},
+			wantErr: ErrCompareFailed,
+			want:    map[string]string{},
+		},
+		{
+			name: "cas create when key does not exist",
+			data: map[string]string{},
+			cmd:  command{Op: opCAS, Key: "a", Value: "1"},
+			want: map[string]string{"a": "1"},
+		},
+		{
+			name:    "cas create miss when key exists",
+			data:    map[string]string{"a": "1"},
+			cmd:     command{Op: opCAS, Key: "a", Value: "2"},
+			wantErr: ErrCompareFailed,
+			want:    map[string]string{"a": "1"},
+		},
+		{
+			name:    "unknown op",
+			data:    map[string]string{"a": "1"},
+			cmd:     command{Op: "unknown", Key: "a"},
+			wantErr: errors.New(`unknown command "unknown"`),
+			want:    map[string]string{"a": "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			fsm := NewFSM()
+			fsm.data = tt.data
+
+			resp := fsm.Apply(commandLog(t, tt.cmd))
+
+			err, _ := resp.(error)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case tt.wantErr != nil && err == nil:
+				t.Fatalf("expected error %q, got nil", tt.wantErr)
+			case tt.wantErr != nil && err.Error() != tt.wantErr.Error():
+				t.Fatalf("expected error %q, got %q", tt.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(fsm.data, tt.want) {
+				t.Fatalf("expected data %v, got %v", tt.want, fsm.data)
+			}
+		})
+	}
+}
+
+func TestFSMApplyIgnoresNonCommandLog(t *testing.T) {
+
+	fsm := NewFSM()
+	if resp := fsm.Apply(&raft.Log{Type: raft.LogConfiguration, Data: []byte("not json")}); resp != nil {
+		t.Fatalf("expected nil response, got %v", resp)
+	}
+}
+
+func TestFSMSnapshotRestore(t *testing.T) {
+
+	fsm := NewFSM()
+	for key, value := range map[string]string{"a": "1", "b": "", "c/d": "3"} {
+		if resp := fsm.Apply(commandLog(t, command{Op: opSet, Key: key, Value: value})); resp != nil {
+			t.Fatalf("set %s: %v", key, resp)
+		}
+	}
+
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 生成快照后的修改不能影响快照内容
+	fsm.Apply(commandLog(t, command{Op: opSet, Key: "a", Value: "changed"}))
+
+	sink := &memorySink{}
+	if err = snapshot.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	if sink.canceled {
+		t.Fatal("sink is canceled")
+	}
+
+	var encoded snapshotData
+	if err = json.Unmarshal(sink.Bytes(), &encoded); err != nil {
+		t.Fatal(err)
+	}
+	if encoded.Version != snapshotVersion {
+		t.Fatalf("expected snapshot version %d, got %d", snapshotVersion, encoded.Version)
+	}
+
+	restored := NewFSM()
+	restored.data["stale"] = "x"
+	if err = restored.Restore(io.NopCloser(bytes.NewReader(sink.Bytes()))); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"a": "1", "b": "", "c/d": "3"}
+	if !reflect.DeepEqual(restored.data, want) {
+		t.Fatalf("expected data %v, got %v", want, restored.data)
+	}
+}
+
+func TestFSMRestoreUnsupportedVersion(t *testing.T) {
+
+	fsm := NewFSM()
+	fsm.data["a"] = "1"
+
+	err := fsm.Restore(io.NopCloser(strings.NewReader(`{"version":99,"data":{"b":"2"}}`)))
+	if err == nil || !strings.Contains(err.Error(), "unsupported snapshot version 99") {
+		t.Fatalf("expected unsupported version error, got %v", err)
+	}
+
+	// 恢复失败时保留原有数据
+	if want := map[string]string{"a": "1"}; !reflect.DeepEqual(fsm.data, want) {
+		t.Fatalf("expected data %v, got %v", want, fsm.data)
+	}
+}
+
+func TestFSMRestorePreUpgradeSnapshot(t *testing.T) {
+
+	// 升级前 Persist 不写入任何内容，快照可能为空或者没有版本号
+	for _, body := range []string{"", "\n", "{}", `{"version":0}`} {
+		fsm := NewFSM()
+		fsm.data["stale"] = "x"
+
+		if err := fsm.Restore(io.NopCloser(strings.NewReader(body))); err != nil {
+			t.Fatalf("restore %q: %s", body, err)
+		}
+		if len(fsm.data) != 0 {
+			t.Fatalf("restore %q: expected empty data, got %v", body, fsm.data)
+		}
+	}
+}
@@ -1,10 +1,18 @@
 package consensus
 
 import (
+	"errors"
 	"fmt"
 	"github.com/hashicorp/raft"
 )
 
+var (
+	ErrAddressConflict = errors.New("address conflict")
+	ErrMemberNotFound  = errors.New("member not found")
+	// ErrAPIAddressRequired 开启 autopilot 时 leader 需要通过成员的 api 地址读取复制进度，没有 api 地址的成员不会被提升
+	ErrAPIAddressRequired = errors.New("api address is required when autopilot is enabled")
+)
+
 func (m *Manager) Status() (*ClusterState, error) {
 
 	if m.Raft == nil {
@@ -19,16 +27,28 @@ func (m *Manager) Status() (*ClusterState, error) {
 		return nil, err
 	}
 
-	return &ClusterState{
-		Members:  future.Configuration().Servers,
-		ID:       m.id,
-		LeaderID: string(leaderID),
-		Status:   m.Raft.State().String(),
-	}, nil
+	state := &ClusterState{
+		Members:    future.Configuration().Servers,
+		ID:         m.id,
+		LeaderID:   string(leaderID),
+		Status:     m.Raft.State().String(),
+		Priorities: m.Priorities(),
+		APIs:       m.APIAddresses(),
+		LastIndex:  m.Raft.LastIndex(),
+	}
+	if until, held := m.PreemptHeldUntil(); held {
+		state.PreemptHeldUntil = &until
+	}
+	if staging := m.Staging(); len(staging) != 0 {
+		state.Staging = staging
+	}
+
+	return state, nil
 
 }
 
-func (m *Manager) AddMember(memberID, address string, nonVoter bool) error {
+// AddMember 添加成员，apiAddress 不为空时同时记录成员的 api 地址
+func (m *Manager) AddMember(memberID, address, apiAddress string, nonVoter bool) error {
 
 	if err := m.leaderCheck(); err != nil {
 		return err
@@ -39,14 +59,30 @@ func (m *Manager) AddMember(memberID, address string, nonVoter bool) error {
 		return err
 	}
 
+	exists := false
 	for _, member := range cstate.Members {
 		if raft.ServerID(memberID) == member.ID {
-			return nil
+			exists = true
+			continue
 		}
 		if raft.ServerAddress(address) == member.Address {
-			return fmt.Errorf("%s conflict with %s", memberID, member.ID)
+			return fmt.Errorf("%w: %s is used by %s", ErrAddressConflict, address, member.ID)
+		}
+	}
+
+	if !exists && !nonVoter && m.autopilot.Enable && apiAddress == "" {
+		return fmt.Errorf("%w: %s", ErrAPIAddressRequired, memberID)
+	}
+
+	// 先记录 api 地址，autopilot 检查复制进度时可以读取到
+	if apiAddress != "" {
+		if err = m.SetAPIAddress(memberID, apiAddress); err != nil {
+			return err
 		}
 	}
+	if exists {
+		return nil
+	}
 
 	// TODO: 单节点添加第二个 Member 时， 需要先启动被添加节点否者会导致服务不可用
 	m.lock.Lock()
@@ -56,6 +92,14 @@ func (m *Manager) AddMember(memberID, address string, nonVoter bool) error {
 		return m.Raft.AddNonvoter(raft.ServerID(memberID), raft.ServerAddress(address), 0, memberOperTimeout).Error()
 	}
 
+	// 开启 autopilot 时先以 non-voter 添加，日志追上后由 autopilot 提升为 voter
+	if m.autopilot.Enable {
+		if err = m.setInternal(stagingKeyPrefix+memberID, address); err != nil {
+			return err
+		}
+		return m.Raft.AddNonvoter(raft.ServerID(memberID), raft.ServerAddress(address), 0, memberOperTimeout).Error()
+	}
+
 	return m.Raft.AddVoter(raft.ServerID(memberID), raft.ServerAddress(address), 0, memberOperTimeout).Error()
 }
 
@@ -65,10 +109,130 @@ func (m *Manager) DelMember(memberID string) error {
 		return err
 	}
 
+	return m.removeMember(raft.ServerID(memberID))
+}
+
+// memberKeyPrefixes 是按成员记录的内部 key，删除成员时一并清理
+var memberKeyPrefixes = []string{
+	apiKeyPrefix,
+	priorityKeyPrefix,
+	nopreemptKeyPrefix,
+	unhealthyKeyPrefix,
+	demotedKeyPrefix,
+	stagingKeyPrefix,
+}
+
+// removeMember 从集群配置中删除成员并清理成员的内部 key，DelMember 与 reaper 共用
+func (m *Manager) removeMember(id raft.ServerID) error {
+
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	return m.Raft.RemoveServer(raft.ServerID(memberID), 0, memberOperTimeout).Error()
+	if err := m.Raft.RemoveServer(id, 0, memberOperTimeout).Error(); err != nil {
+		return err
+	}
+
+	for _, prefix := range memberKeyPrefixes {
+		if _, ok := m.fsm.Get(prefix + string(id)); !ok {
+			continue
+		}
+		if err := m.deleteInternal(prefix + string(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TransferLeadership 将 leader 转移到指定成员，memberID 为空时选择已知健康且优先级最高的成员，
+// 没有符合条件的成员时由 raft 选择日志最新的成员
+func (m *Manager) TransferLeadership(memberID string) error {
+
+	if err := m.leaderCheck(); err != nil {
+		return err
+	}
+
+	if memberID == "" {
+		target, err := m.healthyTarget()
+		if err != nil {
+			return err
+		}
+		if target != nil {
+			return m.Raft.LeadershipTransferToServer(target.ID, target.Address).Error()
+		}
+		return m.Raft.LeadershipTransfer().Error()
+	}
+
+	cstate, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	for _, member := range cstate.Members {
+		if raft.ServerID(memberID) == member.ID {
+			return m.Raft.LeadershipTransferToServer(member.ID, member.Address).Error()
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrMemberNotFound, memberID)
+}
+
+// Ready 检查 raft 是否正在运行并且已知 leader
+func (m *Manager) Ready() error {
+
+	if m.Raft == nil {
+		return fmt.Errorf("raft is not init")
+	}
+
+	if m.Raft.State() == raft.Shutdown {
+		return fmt.Errorf("raft is shutdown")
+	}
+
+	if _, leaderID := m.Raft.LeaderWithID(); leaderID == "" {
+		return fmt.Errorf("leader is unknown")
+	}
+
+	return nil
+}
+
+// IsMember 检查当前节点是否已经在集群配置中
+func (m *Manager) IsMember() (bool, error) {
+
+	cstate, err := m.Status()
+	if err != nil {
+		return false, err
+	}
+
+	for _, member := range cstate.Members {
+		if member.ID == raft.ServerID(m.id) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// HasOtherVoters 检查集群中是否还有其他 voter，没有时无法转移 leader
+func (m *Manager) HasOtherVoters() bool {
+
+	if m.Raft == nil {
+		return false
+	}
+
+	future := m.Raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return false
+	}
+
+	for _, server := range future.Configuration().Servers {
+		if server.ID != raft.ServerID(m.id) && server.Suffrage == raft.Voter {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) IsLeader() bool {
+	return m.Raft != nil && m.Raft.State() == raft.Leader
 }
 
 func (m *Manager) leaderCheck() error {
@@ -80,7 +244,7 @@ func (m *Manager) leaderCheck() error {
 	_, leaderID := m.Raft.LeaderWithID()
 
 	if raft.ServerID(m.id) != leaderID {
-		return fmt.Errorf("only add member on leader")
+		return raft.ErrNotLeader
 	}
 
 	return nil
@@ -0,0 +1,249 @@
+package consensus
+
+import (
+	"github.com/hashicorp/raft"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	// unhealthyKeyPrefix 记录成员通告的不健康状态，成员恢复健康后删除
+	unhealthyKeyPrefix = internalKeyPrefix + "unhealthy/"
+	// demotedKeyPrefix 记录因为不健康被降级为 non-voter 的成员，恢复健康后重新提升为 voter
+	demotedKeyPrefix   = internalKeyPrefix + "demoted/"
+	defaultMinVoters   = 3
+	healthGateInterval = 2 * time.Second
+	stepDownHold       = 10 * time.Minute
+)
+
+// HealthChecker 返回当前节点上 VIP 后端服务是否健康
+type HealthChecker interface {
+	Healthy() bool
+}
+
+// Healthy 返回成员通告的健康状态，没有通告的成员视为健康
+func (m *Manager) Healthy(memberID string) bool {
+	_, ok := m.fsm.Get(unhealthyKeyPrefix + memberID)
+	return !ok
+}
+
+func (m *Manager) setHealth(memberID string, healthy bool) error {
+
+	switch {
+	case healthy && !m.Healthy(memberID):
+		return m.deleteInternal(unhealthyKeyPrefix + memberID)
+	case !healthy && m.Healthy(memberID):
+		return m.setInternal(unhealthyKeyPrefix+memberID, time.Now().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// WatchHealth 在当前节点是 leader 且不健康时将 leader 转移给已知健康的成员。
+// 成为 leader 时立即检查，不健康的节点当选后会马上让出 leader，尽量缩短持有 VIP 的时间
+func (m *Manager) WatchHealth(checker HealthChecker, interval time.Duration) {
+
+	leaderCh := make(chan raft.Observation, 1)
+	m.Raft.RegisterObserver(raft.NewObserver(leaderCh, false, func(o *raft.Observation) bool {
+		_, ok := o.Data.(raft.LeaderObservation)
+		return ok
+	}))
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-leaderCh:
+			case <-m.stopCh:
+				return
+			}
+
+			if !m.IsLeader() || checker.Healthy() {
+				continue
+			}
+
+			if err := m.stepDownUnhealthy(); err != nil {
+				log.WithError(err).Error("Transfer leadership from unhealthy leader failure")
+			}
+		}
+	}()
+}
+
+// stepDownUnhealthy 先通告当前节点不健康，避免 leader 被优先级抢占转移回来，再将 leader 转移给健康的成员
+func (m *Manager) stepDownUnhealthy() error {
+
+	if err := m.setHealth(m.id, false); err != nil {
+		log.WithError(err).Warn("Mark unhealthy failure")
+	}
+
+	target, err := m.healthyTarget()
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		log.Warn("Leader is unhealthy, but no healthy member can take over")
+		return nil
+	}
+
+	log.WithField("id", target.ID).Warn("Leader is unhealthy, transfer leadership to healthy member")
+	return m.Raft.LeadershipTransferToServer(target.ID, target.Address).Error()
+}
+
+// StepDown 主动让出 leader，例如成为 leader 后执行的脚本失败。与 leader 不健康时一致先通告当前节点不健康，
+// 并在 stepDownHold 时间内保持不健康，避免优先级抢占很快将 leader 转移回来后再次失败
+func (m *Manager) StepDown(reason string) error {
+
+	if err := m.leaderCheck(); err != nil {
+		return err
+	}
+
+	m.stepDownLock.Lock()
+	m.stepDownUntil = time.Now().Add(stepDownHold)
+	m.stepDownLock.Unlock()
+
+	log.WithFields(log.Fields{"reason": reason, "hold": stepDownHold}).Warn("Step down")
+	return m.stepDownUnhealthy()
+}
+
+// SteppedDown 返回当前节点是否在主动让出 leader 后的保持时间内，此时成员通告自己不健康
+func (m *Manager) SteppedDown() bool {
+
+	m.stepDownLock.Lock()
+	defer m.stepDownLock.Unlock()
+
+	return time.Now().Before(m.stepDownUntil)
+}
+
+// healthyTarget 返回心跳正常、已知健康并且优先级最高的 voter，没有符合条件的成员时返回 nil
+func (m *Manager) healthyTarget() (*raft.Server, error) {
+
+	servers, err := m.servers()
+	if err != nil {
+		return nil, err
+	}
+
+	var target *raft.Server
+	for i, server := range servers {
+		if server.ID == raft.ServerID(m.id) || server.Suffrage != raft.Voter {
+			continue
+		}
+		if m.peers.get(server.ID).Failed || !m.Healthy(string(server.ID)) {
+			continue
+		}
+		if target == nil || m.priority(server.ID) > m.priority(target.ID) {
+			target = &servers[i]
+		}
+	}
+	return target, nil
+}
+
+// runHealthGate 在 leader 上将不健康的 voter 降级为 non-voter，使其无法在选举中当选，恢复健康后重新提升为 voter。
+// 降级后 voter 数量不能少于 min_voters，无法降级的不健康成员当选后由 WatchHealth 立即转移 leader
+func (m *Manager) runHealthGate() {
+
+	minVoters := m.minVoters
+	if minVoters <= 0 {
+		minVoters = defaultMinVoters
+	}
+
+	go func() {
+		ticker := time.NewTicker(healthGateInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.stopCh:
+				return
+			}
+
+			if !m.IsLeader() {
+				continue
+			}
+
+			if err := m.healthGate(minVoters); err != nil {
+				log.WithError(err).Error("Update suffrage of unhealthy member failure")
+			}
+		}
+	}()
+}
+
+func (m *Manager) healthGate(minVoters int) error {
+
+	servers, err := m.servers()
+	if err != nil {
+		return err
+	}
+
+	voters := 0
+	for _, server := range servers {
+		if server.Suffrage == raft.Voter {
+			voters++
+		}
+	}
+
+	demoted := m.fsm.List(demotedKeyPrefix)
+	for _, server := range servers {
+		key := demotedKeyPrefix + string(server.ID)
+		_, wasDemoted := demoted[key]
+		delete(demoted, key)
+
+		// leader 不健康时由 WatchHealth 转移 leader，新的 leader 再将其降级
+		if server.ID == raft.ServerID(m.id) {
+			continue
+		}
+
+		healthy := m.Healthy(string(server.ID))
+		fields := log.Fields{"id": server.ID, "address": server.Address}
+
+		switch {
+		case server.Suffrage == raft.Voter && !healthy:
+			if voters-1 < minVoters {
+				log.WithFields(fields).WithField("min_voters", minVoters).Debug("Skip demoting unhealthy member, voters would drop below min voters")
+				continue
+			}
+			log.WithFields(fields).Warn("Demote unhealthy member to non-voter")
+			// 先写入记录，降级失败时下次检查会重试
+			if err = m.setInternal(key, time.Now().Format(time.RFC3339)); err != nil {
+				return err
+			}
+			if err = m.demote(server); err != nil {
+				return err
+			}
+			voters--
+		case server.Suffrage == raft.Nonvoter && wasDemoted && healthy:
+			log.WithFields(fields).Info("Promote recovered member to voter")
+			if err = m.promote(server); err != nil {
+				return err
+			}
+			voters++
+			if err = m.deleteInternal(key); err != nil {
+				return err
+			}
+		case server.Suffrage == raft.Voter && wasDemoted:
+			// 降级失败或者已经被其他方式提升为 voter
+			if err = m.deleteInternal(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 删除已经不在集群中的成员的降级记录
+	for key := range demoted {
+		if err = m.deleteInternal(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) demote(server raft.Server) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.Raft.DemoteVoter(server.ID, 0, memberOperTimeout).Error()
+}
@@ -0,0 +1,42 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+)
+
+// TestStepDown 检查主动让出 leader 后当前节点被标记为不健康，不会被选为转移目标
+func TestStepDown(t *testing.T) {
+
+	managers := newTestManagers("n1", "n2", "n3")
+	startTestCluster(t, managers)
+
+	leader := waitLeader(t, managers)
+	if err := leader.StepDown("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !leader.SteppedDown() {
+		t.Fatal("expected leader to be stepped down")
+	}
+	if leader.Healthy(leader.id) {
+		t.Fatal("expected stepped down leader to be unhealthy")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for leader.IsLeader() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if leader.IsLeader() {
+		t.Fatal("expected leadership to be transferred")
+	}
+
+	next := waitLeader(t, managers)
+	target, err := next.healthyTarget()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != nil && string(target.ID) == leader.id {
+		t.Fatalf("expected stepped down member not to be a transfer target")
+	}
+}
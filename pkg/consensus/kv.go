@@ -0,0 +1,116 @@
+package consensus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrReservedKey 表示 key 位于内部使用的命名空间，不能通过 /kv 读写
+var ErrReservedKey = errors.New("key is reserved")
+
+// checkKey 拒绝读写内部 key，避免用户修改优先级、健康状态等集群内部状态
+func checkKey(key string) error {
+
+	if strings.HasPrefix(key, internalKeyPrefix) {
+		return fmt.Errorf("%w: %s is used internally", ErrReservedKey, internalKeyPrefix)
+	}
+	return nil
+}
+
+func (m *Manager) Get(key string) (string, error) {
+
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	value, ok := m.fsm.Get(key)
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	return value, nil
+}
+
+func (m *Manager) Set(key, value string) error {
+
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return m.apply(command{Op: opSet, Key: key, Value: value})
+}
+
+func (m *Manager) Delete(key string) error {
+
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return m.apply(command{Op: opDelete, Key: key})
+}
+
+// CompareAndSwap 在 key 当前值等于 prevValue 时写入 value，prevValue 为 nil 时要求 key 不存在
+func (m *Manager) CompareAndSwap(key string, prevValue *string, value string) error {
+
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return m.apply(command{Op: opCAS, Key: key, Value: value, PrevValue: prevValue})
+}
+
+// setInternal 写入内部 key，仅供 consensus 内部使用
+func (m *Manager) setInternal(key, value string) error {
+	return m.apply(command{Op: opSet, Key: key, Value: value})
+}
+
+func (m *Manager) deleteInternal(key string) error {
+	return m.apply(command{Op: opDelete, Key: key})
+}
+
+func (m *Manager) apply(c command) error {
+
+	if m.Raft == nil {
+		return fmt.Errorf("raft is not init")
+	}
+
+	if c.Key == "" {
+		return fmt.Errorf("key is empty")
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	future := m.Raft.Apply(data, applyOperTimeout)
+	if err = future.Error(); err != nil {
+		return err
+	}
+
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// ConsistentGet 仅在 leader 上执行，确认 leader 身份并等待之前的日志全部应用后再读取，避免读到旧数据
+func (m *Manager) ConsistentGet(key string) (string, error) {
+
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	if m.Raft == nil {
+		return "", fmt.Errorf("raft is not init")
+	}
+
+	if err := m.Raft.VerifyLeader().Error(); err != nil {
+		return "", err
+	}
+
+	if err := m.Raft.Barrier(applyOperTimeout).Error(); err != nil {
+		return "", err
+	}
+
+	return m.Get(key)
+}
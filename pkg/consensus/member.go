@@ -0,0 +1,41 @@
+package consensus
+
+import (
+	"fmt"
+	"github.com/hashicorp/raft"
+)
+
+// MemberState 成员自己通告的状态，由成员周期发送给 leader 写入集群
+type MemberState struct {
+	Healthy   bool `json:"healthy"`
+	NoPreempt bool `json:"nopreempt"`
+}
+
+// SetMemberState 记录成员通告的状态
+func (m *Manager) SetMemberState(memberID string, state MemberState) error {
+
+	if err := m.leaderCheck(); err != nil {
+		return err
+	}
+
+	servers, err := m.servers()
+	if err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		if server.ID == raft.ServerID(memberID) {
+			if err = m.setHealth(memberID, state.Healthy); err != nil {
+				return err
+			}
+			return m.setNoPreempt(memberID, state.NoPreempt)
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrMemberNotFound, memberID)
+}
+
+// MemberState 返回集群中记录的成员状态
+func (m *Manager) MemberState(memberID string) MemberState {
+	return MemberState{Healthy: m.Healthy(memberID), NoPreempt: m.noPreempt(raft.ServerID(memberID))}
+}
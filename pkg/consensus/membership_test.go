@@ -0,0 +1,107 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QQGoblin/veteran/pkg/membership"
+	"github.com/hashicorp/raft"
+)
+
+// TestFollowerMembership 检查 follower 也能根据配置日志收到成员变化
+func TestFollowerMembership(t *testing.T) {
+
+	managers := newTestManagers("n1", "n2", "n3")
+	changes := make(map[string]chan membership.Change)
+	for _, m := range managers {
+		ch := make(chan membership.Change, 8)
+		changes[m.id] = ch
+		m.fsm.onMembership = func(cs []membership.Change) {
+			for _, c := range cs {
+				ch <- c
+			}
+		}
+	}
+	startTestCluster(t, managers)
+
+	leader := waitLeader(t, managers)
+	var follower *Manager
+	for _, m := range managers {
+		if m != leader {
+			follower = m
+			break
+		}
+	}
+
+	// n4 不需要真的启动，原有三个成员即可提交新的配置
+	if err := leader.Raft.AddNonvoter("n4", "n4", 0, time.Second).Error(); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(t, changes[follower.id], membership.Change{Server: raft.Server{Suffrage: raft.Nonvoter, ID: "n4", Address: "n4"}})
+
+	if err := leader.Raft.RemoveServer("n4", 0, time.Second).Error(); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(t, changes[follower.id], membership.Change{Server: raft.Server{Suffrage: raft.Nonvoter, ID: "n4", Address: "n4"}, Removed: true})
+}
+
+func expectChange(t *testing.T, ch chan membership.Change, want membership.Change) {
+	t.Helper()
+
+	select {
+	case change := <-ch:
+		if change != want {
+			t.Fatalf("expected change %v, got %v", want, change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("change %v is not received", want)
+	}
+}
+
+// TestDelMemberCleanup 检查删除成员时清理成员的所有内部 key
+func TestDelMemberCleanup(t *testing.T) {
+
+	managers := newTestManagers("n1", "n2", "n3")
+	startTestCluster(t, managers)
+
+	leader := waitLeader(t, managers)
+	if err := leader.AddMember("n4", "n4", "http://n4:27000", true); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		leader.SetPriority("n4", 10),
+		leader.setNoPreempt("n4", true),
+		leader.setHealth("n4", false),
+		leader.setInternal(demotedKeyPrefix+"n4", "n4"),
+		leader.setInternal(stagingKeyPrefix+"n4", "n4"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := leader.DelMember("n4"); err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range memberKeyPrefixes {
+		if _, ok := leader.fsm.Get(prefix + "n4"); ok {
+			t.Fatalf("expected %s to be deleted", prefix+"n4")
+		}
+	}
+}
+
+// TestHasOtherVoters 检查单个 voter 的集群没有可以转移 leader 的目标
+func TestHasOtherVoters(t *testing.T) {
+
+	single := newTestManagers("n1")
+	startTestCluster(t, single)
+	if leader := waitLeader(t, single); leader.HasOtherVoters() {
+		t.Fatal("expected single voter cluster to have no other voters")
+	}
+
+	managers := newTestManagers("n1", "n2", "n3")
+	startTestCluster(t, managers)
+	if leader := waitLeader(t, managers); !leader.HasOtherVoters() {
+		t.Fatal("expected other voters in three member cluster")
+	}
+}
@@ -0,0 +1,197 @@
+package consensus
+
+import (
+	"fmt"
+	"github.com/hashicorp/raft"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	internalKeyPrefix   = "veteran/"
+	priorityKeyPrefix   = internalKeyPrefix + "priority/"
+	defaultPreemptDelay = 30 * time.Second
+	preemptInterval     = 5 * time.Second
+	// nopreemptKeyPrefix 记录配置了 nopreempt 的成员，这些成员不会通过优先级抢占 leader
+	nopreemptKeyPrefix = internalKeyPrefix + "nopreempt/"
+	// preemptHoldKey 记录暂停抢占的截止时间，手动转移 leader 后写入，避免抢占将 leader 转移回去
+	preemptHoldKey = internalKeyPrefix + "preempt/hold"
+)
+
+// SetPriority 设置成员优先级，保存在 FSM 中
+func (m *Manager) SetPriority(memberID string, priority int) error {
+
+	if err := m.leaderCheck(); err != nil {
+		return err
+	}
+
+	return m.setInternal(priorityKeyPrefix+memberID, strconv.Itoa(priority))
+}
+
+// Priorities 返回集群中记录的所有成员优先级
+func (m *Manager) Priorities() map[string]int {
+
+	priorities := make(map[string]int)
+	for key, value := range m.fsm.List(priorityKeyPrefix) {
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		priorities[strings.TrimPrefix(key, priorityKeyPrefix)] = priority
+	}
+	return priorities
+}
+
+func (m *Manager) priority(memberID raft.ServerID) int {
+
+	value, ok := m.fsm.Get(priorityKeyPrefix + string(memberID))
+	if !ok {
+		return 0
+	}
+	priority, _ := strconv.Atoi(value)
+	return priority
+}
+
+// HasPriority 返回集群中是否记录了成员优先级，成员只在没有记录时通告配置的优先级，不会覆盖通过 api 设置的值
+func (m *Manager) HasPriority(memberID string) bool {
+	_, ok := m.fsm.Get(priorityKeyPrefix + memberID)
+	return ok
+}
+
+func (m *Manager) noPreempt(memberID raft.ServerID) bool {
+	_, ok := m.fsm.Get(nopreemptKeyPrefix + string(memberID))
+	return ok
+}
+
+func (m *Manager) setNoPreempt(memberID string, noPreempt bool) error {
+
+	switch {
+	case noPreempt && !m.noPreempt(raft.ServerID(memberID)):
+		return m.setInternal(nopreemptKeyPrefix+memberID, "true")
+	case !noPreempt && m.noPreempt(raft.ServerID(memberID)):
+		return m.deleteInternal(nopreemptKeyPrefix + memberID)
+	}
+	return nil
+}
+
+// HoldPreempt 在 hold 时间内暂停抢占，例如手动转移 leader 进行维护期间
+func (m *Manager) HoldPreempt(hold time.Duration) error {
+
+	if err := m.leaderCheck(); err != nil {
+		return err
+	}
+
+	return m.setInternal(preemptHoldKey, time.Now().Add(hold).Format(time.RFC3339))
+}
+
+// ResumePreempt 恢复被 HoldPreempt 暂停的抢占
+func (m *Manager) ResumePreempt() error {
+
+	if err := m.leaderCheck(); err != nil {
+		return err
+	}
+
+	if _, ok := m.fsm.Get(preemptHoldKey); !ok {
+		return nil
+	}
+	return m.deleteInternal(preemptHoldKey)
+}
+
+// PreemptHeldUntil 返回抢占暂停的截止时间，没有暂停或者已经过期时返回 false
+func (m *Manager) PreemptHeldUntil() (time.Time, bool) {
+
+	value, ok := m.fsm.Get(preemptHoldKey)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil || !time.Now().Before(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// runPreempt 在 leader 上周期执行，将 leader 转移给稳定、健康且优先级更高的成员。
+// 与 VRRP 一致，配置了 nopreempt 的成员不会抢占优先级更低的 leader，手动转移 leader 后暂停抢占
+func (m *Manager) runPreempt() {
+
+	delay := time.Duration(m.preempt.Delay)
+	if delay <= 0 {
+		delay = defaultPreemptDelay
+	}
+
+	go func() {
+		ticker := time.NewTicker(preemptInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.stopCh:
+				return
+			}
+
+			if !m.IsLeader() {
+				continue
+			}
+
+			if err := m.preemptCheck(delay); err != nil {
+				log.WithError(err).Error("Transfer leadership to higher priority member failure")
+			}
+		}
+	}()
+}
+
+func (m *Manager) preemptCheck(delay time.Duration) error {
+
+	if until, held := m.PreemptHeldUntil(); held {
+		log.WithField("until", until.Format(time.RFC3339)).Debug("Preemption is held")
+		return nil
+	}
+
+	// 删除已经过期的暂停记录
+	if _, ok := m.fsm.Get(preemptHoldKey); ok {
+		if err := m.deleteInternal(preemptHoldKey); err != nil {
+			return err
+		}
+	}
+
+	future := m.Raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+
+	var target *raft.Server
+	best := m.priority(raft.ServerID(m.id))
+	for _, server := range future.Configuration().Servers {
+		if server.ID == raft.ServerID(m.id) || server.Suffrage != raft.Voter {
+			continue
+		}
+
+		priority := m.priority(server.ID)
+		if priority <= best || m.noPreempt(server.ID) {
+			continue
+		}
+
+		state := m.peers.get(server.ID)
+		if state.Failed || time.Since(state.StableSince) < delay || !m.Healthy(string(server.ID)) {
+			continue
+		}
+
+		best = priority
+		target = &server
+	}
+
+	if target == nil {
+		return nil
+	}
+
+	log.WithFields(log.Fields{"id": target.ID, "priority": best}).Info("Transfer leadership to higher priority member")
+	if err := m.Raft.LeadershipTransferToServer(target.ID, target.Address).Error(); err != nil {
+		return fmt.Errorf("transfer to %s: %s", target.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPreemptHold 检查手动转移 leader 后暂停抢占，恢复或者过期后优先级更高的成员重新抢占 leader
+func TestPreemptHold(t *testing.T) {
+
+	managers := newTestManagers("n1", "n2", "n3")
+	startTestCluster(t, managers)
+
+	leader := waitLeader(t, managers)
+	var preferred *Manager
+	for _, m := range managers {
+		if m != leader {
+			preferred = m
+			break
+		}
+	}
+	if err := leader.SetPriority(preferred.id, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := leader.HoldPreempt(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, held := leader.PreemptHeldUntil(); !held {
+		t.Fatal("expected preemption to be held")
+	}
+	if err := leader.preemptCheck(0); err != nil {
+		t.Fatal(err)
+	}
+	if !leader.IsLeader() {
+		t.Fatal("expected held preemption not to transfer leadership")
+	}
+
+	// 过期的暂停记录不再阻止抢占，并且会被删除
+	if err := leader.HoldPreempt(-time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, held := leader.PreemptHeldUntil(); held {
+		t.Fatal("expected expired hold to be ignored")
+	}
+	if err := leader.preemptCheck(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := leader.fsm.Get(preemptHoldKey); ok {
+		t.Fatal("expected expired hold to be deleted")
+	}
+
+	next := waitLeader(t, managers)
+	if next != preferred {
+		t.Fatalf("expected leadership to be preempted by %s, got %s", preferred.id, next.id)
+	}
+
+	// 手动转移 leader 到优先级更低的成员，恢复抢占前不会转移回去
+	if err := next.HoldPreempt(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := next.TransferLeadership(leader.id); err != nil {
+		t.Fatal(err)
+	}
+	current := waitLeader(t, managers)
+	if err := current.preemptCheck(0); err != nil {
+		t.Fatal(err)
+	}
+	if !current.IsLeader() {
+		t.Fatal("expected held preemption not to undo the manual transfer")
+	}
+
+	// 恢复抢占后优先级更高的成员重新成为 leader
+	if err := current.ResumePreempt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := current.preemptCheck(0); err != nil {
+		t.Fatal(err)
+	}
+	if next = waitLeader(t, managers); next != preferred {
+		t.Fatalf("expected leadership to be preempted by %s after resume, got %s", preferred.id, next.id)
+	}
+}
@@ -2,6 +2,10 @@ package consensus
 
 import (
 	"fmt"
+	"github.com/QQGoblin/veteran/pkg/config"
+	"github.com/QQGoblin/veteran/pkg/events"
+	"github.com/QQGoblin/veteran/pkg/metrics"
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/raft"
 	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
 	log "github.com/sirupsen/logrus"
@@ -23,26 +27,73 @@ const (
 type Manager struct {
 	id        string
 	initPeers map[string]string
+	join      bool
 	storePath string
-	fsm       FSM
+	snapshot  config.SnapshotConfig
+	fsm       *FSM
+	logger    hclog.Logger
 	lock      sync.Mutex
-	Raft      *raft.Raft
+	stopCh    chan struct{}
+	peers     *peerTracker
+	preempt   config.PreemptConfig
+	autopilot config.AutopilotConfig
+	reaper    config.ReaperConfig
+	minVoters int
+	raftTLS   config.TLSConfig
+	advertise string // 当前节点对外通告的 api 地址
+	progress  ProgressReader
+	// raftLock 保护 TLS 握手期间读取的 Raft 以及 known，握手与 InitRaft 并发执行
+	raftLock sync.RWMutex
+	known    map[raft.ServerID]raft.ServerAddress // 尚未收到集群配置时用于校验对端证书的成员
+	// staging 记录 autopilot 尚未提升成员的原因，只在 leader 上有效
+	stagingLock sync.Mutex
+	staging     map[string]string
+	// stepDownUntil 主动让出 leader 后在该时间之前通告当前节点不健康
+	stepDownLock  sync.Mutex
+	stepDownUntil time.Time
+	Raft          *raft.Raft
 }
 
 type ClusterState struct {
-	Members  []raft.Server `json:"Members"`
-	ID       string        `json:"ID"`
-	LeaderID string        `json:"LeaderID"`
-	Status   string        `json:"Status"`
+	Members    []raft.Server     `json:"Members"`
+	ID         string            `json:"ID"`
+	LeaderID   string            `json:"LeaderID"`
+	Status     string            `json:"Status"`
+	Priorities map[string]int    `json:"Priorities,omitempty"`
+	APIs       map[string]string `json:"APIs,omitempty"`
+	LastIndex  uint64            `json:"LastIndex,omitempty"`
+	// PreemptHeldUntil 手动转移 leader 后暂停抢占的截止时间
+	PreemptHeldUntil *time.Time `json:"PreemptHeldUntil,omitempty"`
+	// Staging 等待 autopilot 提升为 voter 的成员以及尚未提升的原因
+	Staging map[string]string `json:"Staging,omitempty"`
 }
 
-func NewManager(id string, initPeers map[string]string, storePath string) (*Manager, error) {
+func NewManager(c *config.VeteranConfig) (*Manager, error) {
+
+	known := make(map[raft.ServerID]raft.ServerAddress, len(c.InitPeers))
+	for id, address := range c.InitPeers {
+		known[raft.ServerID(id)] = raft.ServerAddress(address)
+	}
+
+	fsm := NewFSM()
+	fsm.onMembership = events.PublishMembership
 
 	return &Manager{
-		id:        id,
-		storePath: storePath,
-		initPeers: initPeers,
-		fsm:       FSM{},
+		id:        c.ID,
+		storePath: c.Store,
+		initPeers: c.InitPeers,
+		join:      len(c.Join) != 0,
+		snapshot:  c.Snapshot,
+		fsm:       fsm,
+		stopCh:    make(chan struct{}),
+		peers:     newPeerTracker(),
+		preempt:   c.Preempt,
+		autopilot: c.Autopilot,
+		reaper:    c.Reaper,
+		minVoters: c.Health.MinVoters,
+		raftTLS:   c.RaftTLS,
+		advertise: c.APIAddress(),
+		known:     known,
 	}, nil
 
 }
@@ -52,9 +103,20 @@ func (m *Manager) InitRaft(logger io.Writer, loglevel string) error {
 	// 初始化配置
 	config := raft.DefaultConfig()
 	config.LocalID = raft.ServerID(m.id)
-	config.NoSnapshotRestoreOnStart = true // 只从快照文件初始集群配置信息
 	config.LogOutput = logger
 	config.LogLevel = loglevel
+	m.logger = hclog.New(&hclog.LoggerOptions{
+		Name:   "raft",
+		Output: logger,
+		Level:  hclog.LevelFromString(loglevel),
+	})
+	config.Logger = m.logger
+	if m.snapshot.Threshold != 0 {
+		config.SnapshotThreshold = m.snapshot.Threshold
+	}
+	if m.snapshot.Interval != 0 {
+		config.SnapshotInterval = time.Duration(m.snapshot.Interval)
+	}
 
 	// 初始化 snapshots 以及 DB
 	if err := os.MkdirAll(m.storePath, 0755); err != nil {
@@ -78,48 +140,93 @@ func (m *Manager) InitRaft(logger io.Writer, loglevel string) error {
 		return err
 	}
 
-	// 初始化 raft 集群
-	if !existing {
-		return m.newCluster(config, boltDB, snapshots)
+	if err = m.recoverCluster(config, boltDB, snapshots); err != nil {
+		return err
 	}
 
-	// 启动 raft 集群
-	transport, err := m.localTransport(boltDB, boltDB, snapshots, logger)
+	switch {
+	case !existing && m.join:
+		// 加入已有集群，等待 leader 添加当前节点
+		err = m.joinCluster(config, boltDB, snapshots)
+	case !existing:
+		// 初始化 raft 集群
+		err = m.newCluster(config, boltDB, snapshots)
+	default:
+		// 启动 raft 集群
+		err = m.startCluster(config, boltDB, snapshots, logger)
+	}
 	if err != nil {
 		return err
 	}
 
-	m.Raft, err = raft.NewRaft(config, m.fsm, boltDB, boltDB, snapshots, transport)
-	return err
+	m.runTracker()
+	m.runPreempt()
+	m.runAutopilot()
+	m.runReaper()
+	m.runAdvertise()
+	m.runHealthGate()
+	metrics.RegisterCollector(m.collectMetrics)
+
+	return nil
 }
 
-func (m *Manager) Shutdown() {
-	shutdownFuture := m.Raft.Shutdown()
-	if err := shutdownFuture.Error(); err != nil {
-		log.WithError(err).Error("Stop raft failed")
+func (m *Manager) startCluster(config *raft.Config, store *raftboltdb.BoltStore, snapshots raft.SnapshotStore, logger io.Writer) error {
+
+	transport, err := m.localTransport(store, store, snapshots, logger)
+	if err != nil {
+		return err
 	}
+
+	return m.startRaft(config, store, snapshots, transport)
 }
 
-func (m *Manager) newCluster(config *raft.Config, store *raftboltdb.BoltStore, snapshots raft.SnapshotStore) error {
+// startRaft 启动 raft，transport 在此之前已经开始接受连接，TLS 握手会并发读取 Raft
+func (m *Manager) startRaft(config *raft.Config, store *raftboltdb.BoltStore, snapshots raft.SnapshotStore, transport raft.Transport) error {
 
-	// 初始化通信接口
-	var bind string
-	for id, address := range m.initPeers {
-		if id == m.id {
-			bind = address
-		}
+	r, err := raft.NewRaft(config, m.fsm, store, store, snapshots, transport)
+	if err != nil {
+		return err
 	}
 
-	if bind == "" {
-		return fmt.Errorf("this node is not found in init peers")
-	}
+	m.raftLock.Lock()
+	m.Raft = r
+	m.raftLock.Unlock()
 
-	address, err := net.ResolveTCPAddr("tcp", bind)
-	if err != nil {
+	// 使用启动时的最新配置作为成员变化的基准，重放的配置日志不会重复发布成员变化
+	future := r.GetConfiguration()
+	if err = future.Error(); err != nil {
 		return err
 	}
+	m.fsm.members.Reset(future.Index(), future.Configuration().Servers)
 
-	transport, err := raft.NewTCPTransport(bind, address, 3, 10*time.Second, config.LogOutput)
+	return nil
+}
+
+// SetLogLevel 动态修改 raft 日志级别
+func (m *Manager) SetLogLevel(loglevel string) error {
+
+	level := hclog.LevelFromString(loglevel)
+	if level == hclog.NoLevel {
+		return fmt.Errorf("invalid raft log level %q", loglevel)
+	}
+
+	if m.logger != nil {
+		m.logger.SetLevel(level)
+	}
+	return nil
+}
+
+func (m *Manager) Shutdown() {
+	close(m.stopCh)
+	shutdownFuture := m.Raft.Shutdown()
+	if err := shutdownFuture.Error(); err != nil {
+		log.WithError(err).Error("Stop raft failed")
+	}
+}
+
+func (m *Manager) newCluster(config *raft.Config, store *raftboltdb.BoltStore, snapshots raft.SnapshotStore) error {
+
+	transport, err := m.initTransport(config.LogOutput)
 	if err != nil {
 		return err
 	}
@@ -133,9 +240,53 @@ func (m *Manager) newCluster(config *raft.Config, store *raftboltdb.BoltStore, s
 	}
 
 	// 启动服务
-	m.Raft, err = raft.NewRaft(config, m.fsm, store, store, snapshots, transport)
+	return m.startRaft(config, store, snapshots, transport)
+}
+
+// joinCluster 不执行 bootstrap，直接启动 raft，节点在 leader 添加后才会收到集群配置
+func (m *Manager) joinCluster(config *raft.Config, store *raftboltdb.BoltStore, snapshots raft.SnapshotStore) error {
 
-	return err
+	transport, err := m.initTransport(config.LogOutput)
+	if err != nil {
+		return err
+	}
+
+	return m.startRaft(config, store, snapshots, transport)
+}
+
+// initTransport 使用 init peers 中当前节点的地址初始化通信接口
+func (m *Manager) initTransport(logger io.Writer) (*raft.NetworkTransport, error) {
+
+	bind := m.Address()
+	if bind == "" {
+		return nil, fmt.Errorf("this node is not found in init peers")
+	}
+
+	return m.newTransport(bind, logger)
+}
+
+// newTransport 配置了 raft_tls 时使用双向 TLS，否则使用明文 TCP
+func (m *Manager) newTransport(bind string, logger io.Writer) (*raft.NetworkTransport, error) {
+
+	address, err := net.ResolveTCPAddr("tcp", bind)
+	if err != nil {
+		return nil, err
+	}
+
+	if !m.raftTLS.Enabled() {
+		return raft.NewTCPTransport(bind, address, 3, 10*time.Second, logger)
+	}
+
+	layer, err := m.newTLSStreamLayer(bind, address)
+	if err != nil {
+		return nil, err
+	}
+	return raft.NewNetworkTransport(layer, 3, 10*time.Second, logger), nil
+}
+
+// Address 返回 init peers 中当前节点的 raft 地址
+func (m *Manager) Address() string {
+	return m.initPeers[m.id]
 }
 
 func (m *Manager) localTransport(logStore raft.LogStore, stableStore raft.StableStore, snapshot raft.SnapshotStore, logger io.Writer) (raft.Transport, error) {
@@ -143,7 +294,8 @@ func (m *Manager) localTransport(logStore raft.LogStore, stableStore raft.Stable
 	temp := raft.DefaultConfig()
 	temp.LocalID = raft.ServerID(m.id)
 	temp.LogOutput = logger
-	configuration, err := raft.GetConfiguration(temp, m.fsm, logStore, stableStore, snapshot, &raft.InmemTransport{})
+	// 使用临时 FSM 读取配置，避免恢复快照时修改正在使用的状态
+	configuration, err := raft.GetConfiguration(temp, NewFSM(), logStore, stableStore, snapshot, &raft.InmemTransport{})
 	if err != nil {
 		return nil, err
 	}
@@ -158,20 +310,7 @@ func (m *Manager) localTransport(logStore raft.LogStore, stableStore raft.Stable
 	if bind == "" {
 		return nil, fmt.Errorf("this node is not found in raft.db")
 	}
+	m.AddKnownServers(configuration.Servers)
 
-	if bind == "" {
-		return nil, fmt.Errorf("this node is not found in raft.db")
-	}
-
-	address, err := net.ResolveTCPAddr("tcp", bind)
-	if err != nil {
-		return nil, err
-	}
-
-	transport, err := raft.NewTCPTransport(bind, address, 3, 10*time.Second, logger)
-	if err != nil {
-		return nil, err
-	}
-
-	return transport, nil
+	return m.newTransport(bind, logger)
 }
@@ -0,0 +1,105 @@
+package consensus
+
+import (
+	"github.com/QQGoblin/veteran/pkg/events"
+	"github.com/hashicorp/raft"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	defaultReapThreshold = time.Hour
+	defaultReapMinQuorum = 3
+	reapInterval         = 10 * time.Second
+)
+
+// runReaper 在 leader 上周期删除心跳持续失败超过阈值的成员，避免离线成员一直占用 quorum。
+// 心跳状态在 leader 切换后重新统计，因此离线时间从当前 leader 第一次发现心跳失败开始计算
+func (m *Manager) runReaper() {
+
+	if !m.reaper.Enable {
+		return
+	}
+
+	threshold := time.Duration(m.reaper.Threshold)
+	if threshold <= 0 {
+		threshold = defaultReapThreshold
+	}
+
+	// 未配置时至少保留 3 个 voter，避免删除离线成员后集群只剩下少数 voter
+	minQuorum := defaultReapMinQuorum
+	if m.reaper.MinQuorum != nil {
+		minQuorum = *m.reaper.MinQuorum
+	}
+
+	go func() {
+		ticker := time.NewTicker(reapInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.stopCh:
+				return
+			}
+
+			if !m.IsLeader() {
+				continue
+			}
+
+			if err := m.reap(threshold, minQuorum); err != nil {
+				log.WithError(err).Error("Remove dead server failure")
+			}
+		}
+	}()
+}
+
+func (m *Manager) reap(threshold time.Duration, minQuorum int) error {
+
+	future := m.Raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+
+	servers := future.Configuration().Servers
+
+	voters := 0
+	for _, server := range servers {
+		if server.Suffrage == raft.Voter {
+			voters++
+		}
+	}
+
+	for _, server := range servers {
+		if server.ID == raft.ServerID(m.id) {
+			continue
+		}
+
+		state := m.peers.get(server.ID)
+		if !state.Failed || time.Since(state.FailedSince) < threshold {
+			continue
+		}
+
+		fields := log.Fields{"id": server.ID, "address": server.Address, "failed_since": state.FailedSince.Format(time.RFC3339)}
+
+		if server.Suffrage == raft.Voter {
+			if voters-1 < minQuorum {
+				log.WithFields(fields).WithField("min_quorum", minQuorum).Warn("Skip removing dead server, voters would drop below min quorum")
+				continue
+			}
+			voters--
+		}
+
+		log.WithFields(fields).Warn("Remove dead server")
+		if err := m.removeMember(server.ID); err != nil {
+			return err
+		}
+		events.Publish(events.TypeDeadServerReaped, "", map[string]string{
+			"id":           string(server.ID),
+			"address":      string(server.Address),
+			"failed_since": state.FailedSince.Format(time.RFC3339),
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package consensus
+
+import (
+	"fmt"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path"
+)
+
+const (
+	// peersFile 放在数据目录下时，启动前使用其中的成员列表恢复集群，格式与 raft peers.json 一致：
+	// [{"id": "node1", "address": "172.28.117.41:27010", "non_voter": false}]
+	peersFile = "peers.json"
+)
+
+// recoverCluster 在大多数成员永久丢失时使用 peers.json 强制修改集群配置，恢复成功后删除 peers.json。
+// 所有存活成员需要使用相同的 peers.json 恢复，否则会出现多个集群
+func (m *Manager) recoverCluster(config *raft.Config, store *raftboltdb.BoltStore, snapshots raft.SnapshotStore) error {
+
+	peers := path.Join(m.storePath, peersFile)
+	if _, err := os.Stat(peers); os.IsNotExist(err) {
+		return nil
+	}
+
+	configuration, err := raft.ReadConfigJSON(peers)
+	if err != nil {
+		return fmt.Errorf("read %s: %s", peers, err)
+	}
+
+	found := false
+	for _, server := range configuration.Servers {
+		if server.ID == raft.ServerID(m.id) {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("this node is not found in %s", peers)
+	}
+
+	log.WithField("servers", configuration.Servers).Warn("Recover cluster from peers.json")
+
+	// 使用临时 FSM 回放日志，启动 raft 时会从恢复生成的快照中还原状态
+	if err = raft.RecoverCluster(config, NewFSM(), store, store, snapshots, &raft.InmemTransport{}, configuration); err != nil {
+		return fmt.Errorf("recover cluster: %s", err)
+	}
+
+	if err = os.Remove(peers); err != nil {
+		return fmt.Errorf("remove %s: %s", peers, err)
+	}
+
+	log.Info("Recover cluster success")
+	return nil
+}
@@ -0,0 +1,213 @@
+package consensus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/tlsutil"
+	"github.com/hashicorp/raft"
+	"net"
+	"time"
+)
+
+// tlsStreamLayer 使用双向 TLS 加密 raft 通信。成员证书需要在 DNS SAN 中包含成员 ID，
+// 连接其他成员时校验对端证书属于目标地址对应的成员，接受连接时校验对端证书属于来源地址对应的成员
+type tlsStreamLayer struct {
+	net.Listener
+	advertise *net.TCPAddr
+	config    *tls.Config
+	m         *Manager
+}
+
+func (m *Manager) newTLSStreamLayer(bind string, advertise *net.TCPAddr) (*tlsStreamLayer, error) {
+
+	cert, pool, err := tlsutil.Load(m.raftTLS)
+	if err != nil {
+		return nil, err
+	}
+	if pool == nil {
+		return nil, fmt.Errorf("raft tls requires ca")
+	}
+
+	layer := &tlsStreamLayer{advertise: advertise, m: m}
+	layer.config = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+
+	serverConfig := layer.config.Clone()
+	serverConfig.GetConfigForClient = layer.configForClient
+
+	listener, err := net.Listen("tcp", bind)
+	if err != nil {
+		return nil, err
+	}
+	layer.Listener = tls.NewListener(listener, serverConfig)
+
+	return layer, nil
+}
+
+func (l *tlsStreamLayer) Addr() net.Addr {
+	return l.advertise
+}
+
+// Dial 连接 address 对应的成员，证书需要包含该成员的 ID。
+// 使用 raft 地址作为源地址，对端根据来源地址确定连接属于哪个成员
+func (l *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+
+	id, err := l.m.memberID(address)
+	if err != nil {
+		return nil, err
+	}
+
+	config := l.config.Clone()
+	config.ServerName = string(id)
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if !l.advertise.IP.IsUnspecified() {
+		dialer.LocalAddr = &net.TCPAddr{IP: l.advertise.IP}
+	}
+
+	return tls.DialWithDialer(dialer, "tcp", string(address), config)
+}
+
+// configForClient 根据连接的来源地址校验对端证书
+func (l *tlsStreamLayer) configForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+
+	config := l.config.Clone()
+	config.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+		return l.verifyClient(hello.Context(), hello.Conn.RemoteAddr(), chains)
+	}
+	return config, nil
+}
+
+// verifyClient 校验对端证书属于来源地址对应的成员，同一个地址上有多个成员时证书属于其中之一即可
+func (l *tlsStreamLayer) verifyClient(ctx context.Context, remote net.Addr, chains [][]*x509.Certificate) error {
+
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return fmt.Errorf("peer certificate is not found")
+	}
+	leaf := chains[0][0]
+
+	tcpAddr, ok := remote.(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("unsupported remote address %s", remote)
+	}
+
+	servers, err := l.m.peerServers()
+	if err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		if !hostMatches(ctx, server.Address, tcpAddr.IP) {
+			continue
+		}
+		if leaf.VerifyHostname(string(server.ID)) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("peer certificate %q does not belong to the member at %s", leaf.Subject.CommonName, tcpAddr.IP)
+}
+
+// hostMatches 检查成员的 raft 地址是否是 ip，地址为域名时解析后比较
+func hostMatches(ctx context.Context, address raft.ServerAddress, ip net.IP) bool {
+
+	host, _, err := net.SplitHostPort(string(address))
+	if err != nil {
+		return false
+	}
+
+	if parsed := net.ParseIP(host); parsed != nil {
+		return parsed.Equal(ip)
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return false
+	}
+	for _, address := range addresses {
+		if address.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddKnownServers 记录集群成员，用于在收到集群配置前校验对端证书，例如加入集群时从 leader 读取的成员
+func (m *Manager) AddKnownServers(servers []raft.Server) {
+
+	m.raftLock.Lock()
+	defer m.raftLock.Unlock()
+
+	for _, server := range servers {
+		m.known[server.ID] = server.Address
+	}
+}
+
+// peerServers 返回可以连接当前节点的成员：有集群配置时只使用集群配置，
+// 否则使用 initial_cluster 以及加入集群前记录的成员
+func (m *Manager) peerServers() ([]raft.Server, error) {
+
+	servers, err := m.servers()
+	if err != nil || len(servers) != 0 {
+		return servers, err
+	}
+
+	m.raftLock.RLock()
+	defer m.raftLock.RUnlock()
+
+	for id, address := range m.known {
+		servers = append(servers, raft.Server{ID: id, Address: address})
+	}
+	return servers, nil
+}
+
+// memberID 返回 raft 地址对应的成员 ID
+func (m *Manager) memberID(address raft.ServerAddress) (raft.ServerID, error) {
+
+	servers, err := m.servers()
+	if err != nil {
+		return "", err
+	}
+
+	for _, server := range servers {
+		if server.Address == address {
+			return server.ID, nil
+		}
+	}
+
+	m.raftLock.RLock()
+	defer m.raftLock.RUnlock()
+
+	for id, known := range m.known {
+		if known == address {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("member with address %s is not found", address)
+}
+
+// servers 返回当前集群配置中的成员，raft 未启动时返回空
+func (m *Manager) servers() ([]raft.Server, error) {
+
+	m.raftLock.RLock()
+	r := m.Raft
+	m.raftLock.RUnlock()
+
+	if r == nil {
+		return nil, nil
+	}
+
+	future := r.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	return future.Configuration().Servers, nil
+}
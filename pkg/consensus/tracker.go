@@ -0,0 +1,162 @@
+package consensus
+
+import (
+	"github.com/QQGoblin/veteran/pkg/metrics"
+	"github.com/hashicorp/raft"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// peerState 记录 leader 视角下 follower 的心跳状态
+type peerState struct {
+	Failed           bool
+	FailedSince      time.Time
+	LastContact      time.Time
+	StableSince      time.Time
+	FailedHeartbeats uint64
+}
+
+// peerTracker 通过 raft observer 记录 follower 心跳失败/恢复，最近通信时间来自 raft 上报的每个成员的复制指标，
+// 只有 leader 上的数据是准确的
+type peerTracker struct {
+	lock    sync.RWMutex
+	resetAt time.Time
+	peers   map[raft.ServerID]*peerState
+}
+
+func newPeerTracker() *peerTracker {
+	return &peerTracker{
+		resetAt: time.Now(),
+		peers:   make(map[raft.ServerID]*peerState),
+	}
+}
+
+func (t *peerTracker) observe(o raft.Observation) {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+
+	switch data := o.Data.(type) {
+	case raft.LeaderObservation:
+		// leader 变化后重新统计
+		t.resetAt = now
+		t.peers = make(map[raft.ServerID]*peerState)
+	case raft.FailedHeartbeatObservation:
+		state := t.getLocked(data.PeerID)
+		if !state.Failed {
+			state.Failed = true
+			state.FailedSince = now
+		}
+		state.LastContact = data.LastContact
+		state.FailedHeartbeats++
+		metrics.PeerFailedHeartbeats.WithLabelValues(string(data.PeerID)).Inc()
+	case raft.ResumedHeartbeatObservation:
+		state := t.getLocked(data.PeerID)
+		state.Failed = false
+		state.StableSince = now
+		state.LastContact = now
+	case raft.PeerObservation:
+		if data.Removed {
+			delete(t.peers, data.Peer.ID)
+		} else {
+			t.getLocked(data.Peer.ID).StableSince = now
+		}
+	}
+}
+
+// snapshot 返回所有 follower 的状态
+func (t *peerTracker) snapshot() map[raft.ServerID]peerState {
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	result := make(map[raft.ServerID]peerState, len(t.peers))
+	for id, state := range t.peers {
+		result[id] = t.withContact(id, *state)
+	}
+	return result
+}
+
+// withContact 使用成为 leader 之后 raft 上报的最近一次成功复制时间更新 LastContact
+func (t *peerTracker) withContact(id raft.ServerID, state peerState) peerState {
+
+	contact := metrics.LastContact(string(id))
+	if contact.After(t.resetAt) && contact.After(state.LastContact) {
+		state.LastContact = contact
+	}
+	return state
+}
+
+func (t *peerTracker) getLocked(id raft.ServerID) *peerState {
+	state, ok := t.peers[id]
+	if !ok {
+		state = &peerState{StableSince: t.resetAt}
+		t.peers[id] = state
+	}
+	return state
+}
+
+func (t *peerTracker) get(id raft.ServerID) peerState {
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if state, ok := t.peers[id]; ok {
+		return t.withContact(id, *state)
+	}
+	return t.withContact(id, peerState{StableSince: t.resetAt})
+}
+
+func (m *Manager) runTracker() {
+
+	observationChan := make(chan raft.Observation, 16)
+	m.Raft.RegisterObserver(raft.NewObserver(observationChan, false, func(o *raft.Observation) bool {
+		switch o.Data.(type) {
+		case raft.LeaderObservation, raft.FailedHeartbeatObservation, raft.ResumedHeartbeatObservation, raft.PeerObservation:
+			return true
+		}
+		return false
+	}))
+
+	go func() {
+		for {
+			select {
+			case o := <-observationChan:
+				m.peers.observe(o)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// collectMetrics 在输出指标前更新 leader、term 以及 follower 最近通信时间
+func (m *Manager) collectMetrics() {
+
+	if m.Raft == nil {
+		return
+	}
+
+	isLeader := 0.0
+	if m.IsLeader() {
+		isLeader = 1
+	}
+	metrics.IsLeader.Set(isLeader)
+
+	if term, err := strconv.ParseUint(m.Raft.Stats()["term"], 10, 64); err == nil {
+		metrics.Term.Set(float64(term))
+	}
+
+	metrics.PeerLastContact.Reset()
+	if isLeader == 0 {
+		return
+	}
+	for id, state := range m.peers.snapshot() {
+		if !state.LastContact.IsZero() {
+			metrics.PeerLastContact.WithLabelValues(string(id)).Set(time.Since(state.LastContact).Seconds())
+		}
+	}
+}
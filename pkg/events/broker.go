@@ -0,0 +1,179 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/QQGoblin/veteran/pkg/membership"
+	"github.com/QQGoblin/veteran/pkg/metrics"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	TypeLeader           = "leader"
+	TypeState            = "state"
+	TypeMemberJoined     = "member_joined"
+	TypeMemberRemoved    = "member_removed"
+	TypeHeartbeatFailed  = "heartbeat_failed"
+	TypeHeartbeatResumed = "heartbeat_resumed"
+	TypeVirtualIPAdded   = "virtual_ip_added"
+	TypeVirtualIPDeleted = "virtual_ip_deleted"
+	TypePluginError      = "plugin_error"
+	TypeDeadServerReaped = "dead_server_reaped"
+)
+
+// types 所有的事件类型
+var types = map[string]struct{}{
+	TypeLeader: {}, TypeState: {}, TypeMemberJoined: {}, TypeMemberRemoved: {}, TypeHeartbeatFailed: {}, TypeHeartbeatResumed: {},
+	TypeVirtualIPAdded: {}, TypeVirtualIPDeleted: {}, TypePluginError: {}, TypeDeadServerReaped: {},
+}
+
+var (
+	broker = &Broker{subscribers: make(map[chan Event]struct{})}
+	// failed 记录已经发布 heartbeat_failed 的成员，心跳恢复或者 leader 变化前不再重复发布
+	failed = &failedPeers{peers: make(map[raft.ServerID]struct{})}
+)
+
+// Event 是推送给 /events 订阅者的集群事件
+type Event struct {
+	Type    string            `json:"type"`
+	Time    time.Time         `json:"time"`
+	Message string            `json:"message,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Broker 将事件广播给所有订阅者，订阅者处理不及时时丢弃事件，发布方不会被阻塞
+type Broker struct {
+	lock        sync.RWMutex
+	subscribers map[chan Event]struct{}
+}
+
+// Known 检查事件类型是否存在，用于校验配置中的事件类型
+func Known(eventType string) bool {
+	_, ok := types[eventType]
+	return ok
+}
+
+func Publish(eventType, message string, fields map[string]string) {
+	broker.Publish(Event{Type: eventType, Time: time.Now(), Message: message, Fields: fields})
+}
+
+func Subscribe(buffer int) (<-chan Event, func()) {
+	return broker.Subscribe(buffer)
+}
+
+func (b *Broker) Publish(e Event) {
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			metrics.EventsDropped.Inc()
+		}
+	}
+}
+
+// Subscribe 返回事件 channel 以及取消订阅的函数
+func (b *Broker) Subscribe(buffer int) (<-chan Event, func()) {
+
+	ch := make(chan Event, buffer)
+
+	b.lock.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.lock.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subscribers, ch)
+			b.lock.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Filter 用于注册 raft observer，只关心会转换为事件的 observation
+func Filter(o *raft.Observation) bool {
+	switch o.Data.(type) {
+	case raft.LeaderObservation, raft.RaftState, raft.FailedHeartbeatObservation, raft.ResumedHeartbeatObservation:
+		return true
+	}
+	return false
+}
+
+// PublishObservation 将 raft observation 转换为事件并发布。
+// raft 每次心跳失败都会发出 FailedHeartbeatObservation，每个成员在恢复前只发布一次 heartbeat_failed
+func PublishObservation(o *raft.Observation) {
+
+	switch data := o.Data.(type) {
+	case raft.LeaderObservation:
+		// 心跳只由 leader 发送，leader 变化后重新计算
+		failed.reset()
+		Publish(TypeLeader, "", map[string]string{"leader_id": string(data.LeaderID), "leader_address": string(data.LeaderAddr)})
+	case raft.RaftState:
+		Publish(TypeState, "", map[string]string{"state": data.String()})
+	case raft.FailedHeartbeatObservation:
+		if failed.add(data.PeerID) {
+			Publish(TypeHeartbeatFailed, "", map[string]string{"id": string(data.PeerID), "last_contact": data.LastContact.Format(time.RFC3339)})
+		}
+	case raft.ResumedHeartbeatObservation:
+		if failed.remove(data.PeerID) {
+			Publish(TypeHeartbeatResumed, "", map[string]string{"id": string(data.PeerID)})
+		}
+	}
+}
+
+// PublishMembership 发布集群配置中的成员变化
+func PublishMembership(changes []membership.Change) {
+
+	for _, change := range changes {
+		eventType := TypeMemberJoined
+		if change.Removed {
+			eventType = TypeMemberRemoved
+		}
+		Publish(eventType, "", map[string]string{"id": string(change.Server.ID), "address": string(change.Server.Address)})
+	}
+}
+
+type failedPeers struct {
+	lock  sync.Mutex
+	peers map[raft.ServerID]struct{}
+}
+
+// add 记录心跳失败的成员，成员已经记录时返回 false
+func (f *failedPeers) add(id raft.ServerID) bool {
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.peers[id]; ok {
+		return false
+	}
+	f.peers[id] = struct{}{}
+	return true
+}
+
+// remove 删除心跳恢复的成员，成员没有记录时返回 false
+func (f *failedPeers) remove(id raft.ServerID) bool {
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.peers[id]; !ok {
+		return false
+	}
+	delete(f.peers, id)
+	return true
+}
+
+func (f *failedPeers) reset() {
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.peers = make(map[raft.ServerID]struct{})
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestPublishHeartbeatOncePerOutage(t *testing.T) {
+
+	ch, cancel := Subscribe(16)
+	defer cancel()
+
+	observations := []interface{}{
+		raft.FailedHeartbeatObservation{PeerID: "n2", LastContact: time.Now()},
+		raft.FailedHeartbeatObservation{PeerID: "n2", LastContact: time.Now()},
+		raft.FailedHeartbeatObservation{PeerID: "n3", LastContact: time.Now()},
+		raft.ResumedHeartbeatObservation{PeerID: "n2"},
+		// 没有发布过 heartbeat_failed 的成员恢复时不发布
+		raft.ResumedHeartbeatObservation{PeerID: "n2"},
+		raft.FailedHeartbeatObservation{PeerID: "n2", LastContact: time.Now()},
+		// leader 变化后重新计算
+		raft.LeaderObservation{LeaderID: "n1", LeaderAddr: "n1"},
+		raft.FailedHeartbeatObservation{PeerID: "n3", LastContact: time.Now()},
+	}
+	for _, o := range observations {
+		PublishObservation(&raft.Observation{Data: o})
+	}
+
+	want := []string{
+		TypeHeartbeatFailed + "/n2",
+		TypeHeartbeatFailed + "/n3",
+		TypeHeartbeatResumed + "/n2",
+		TypeHeartbeatFailed + "/n2",
+		TypeLeader + "/",
+		TypeHeartbeatFailed + "/n3",
+	}
+
+	var got []string
+	for len(got) < len(want) {
+		select {
+		case e := <-ch:
+			got = append(got, e.Type+"/"+e.Fields["id"])
+		case <-time.After(time.Second):
+			t.Fatalf("expected events %v, got %v", want, got)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+
+	select {
+	case e := <-ch:
+		t.Fatalf("unexpected event %v", e)
+	default:
+	}
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	"context"
+	"time"
+)
+
+// Consumer 订阅事件并在单独的 goroutine 中按顺序处理，处理较慢时由 Broker 丢弃事件，不会阻塞发布方
+type Consumer struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Consume 订阅事件并调用 handle 处理，buffer 为等待处理的事件数量，停止时 ctx 会被取消
+func Consume(buffer int, handle func(ctx context.Context, e Event)) *Consumer {
+
+	ch, unsubscribe := Subscribe(buffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Consumer{cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(c.done)
+		defer unsubscribe()
+
+		for {
+			select {
+			case e := <-ch:
+				handle(ctx, e)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return c
+}
+
+// Stop 停止处理事件，最多等待 timeout 让正在处理的事件结束，未处理的事件会被丢弃
+func (c *Consumer) Stop(timeout time.Duration) {
+
+	c.cancel()
+	select {
+	case <-c.done:
+	case <-time.After(timeout):
+	}
+}
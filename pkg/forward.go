@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/tlsutil"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// forwardedHeader 记录转发请求的成员，收到已转发的请求时不再转发，避免 leader 切换期间循环转发
+const forwardedHeader = "X-Veteran-Forwarded-By"
+
+// forwardTransport 转发请求使用的 transport，开启 api_tls 时使用当前节点的 api 证书作为客户端证书
+func (v *Veteran) forwardTransport() (http.RoundTripper, error) {
+
+	if !v.config.APITLS.Enabled() {
+		return http.DefaultTransport, nil
+	}
+
+	tlsConfig, err := tlsutil.ClientConfig(v.config.APITLS.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// forwardMiddleware 将 follower 收到的写请求转发到 leader 通告的 api 地址，读请求仍由当前节点处理。
+// 转发请求使用当前节点的客户端证书，无法代表调用方的证书身份，因此使用客户端证书认证的请求重定向到 leader
+func (v *Veteran) forwardMiddleware(transport http.RoundTripper) func(http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+			if readOnly || v.core.IsLeader() || r.Header.Get(forwardedHeader) != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(v.config.Auth.Users) != 0 && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				v.redirectToLeader(w, r)
+				return
+			}
+
+			leader, err := v.leaderHint()
+			if err != nil {
+				log.WithError(err).WithFields(log.Fields{"method": r.Method, "path": r.URL.Path}).Error("Forward request failure")
+				writeError(w, http.StatusServiceUnavailable, codeNoLeader, err)
+				return
+			}
+
+			target, err := url.Parse(leader.Address)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, codeInternal, fmt.Errorf("parse leader api address %s: %s", leader.Address, err))
+				return
+			}
+
+			proxy := &httputil.ReverseProxy{
+				Rewrite: func(pr *httputil.ProxyRequest) {
+					pr.SetURL(target)
+					pr.SetXForwarded()
+					pr.Out.Header.Set(forwardedHeader, v.config.ID)
+				},
+				Transport: transport,
+				ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+					log.WithError(err).WithFields(log.Fields{"leader": leader.ID, "method": r.Method, "path": r.URL.Path}).Error("Forward request failure")
+					writeError(w, http.StatusBadGateway, codeForwardFailed, err)
+				},
+			}
+
+			log.WithFields(log.Fields{"leader": leader.ID, "method": r.Method, "path": r.URL.Path}).Debug("Forward request to leader")
+			proxy.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/config"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+)
+
+const (
+	TypeTCP  = "tcp"
+	TypeHTTP = "http"
+	TypeExec = "exec"
+)
+
+// Checker 检查 VIP 后端服务是否可用，返回 nil 表示健康
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+func NewChecker(c config.CheckConfig) (Checker, error) {
+
+	if c.Target == "" {
+		return nil, fmt.Errorf("health check %s target is empty", c.Name)
+	}
+
+	switch c.Type {
+	case TypeTCP:
+		return &tcpChecker{address: c.Target}, nil
+	case TypeHTTP:
+		return &httpChecker{url: c.Target}, nil
+	case TypeExec:
+		return &execChecker{command: c.Target, args: c.Args}, nil
+	default:
+		return nil, fmt.Errorf("unknown health check type %q", c.Type)
+	}
+}
+
+type tcpChecker struct {
+	address string
+}
+
+func (c *tcpChecker) Check(ctx context.Context) error {
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+type httpChecker struct {
+	url string
+}
+
+func (c *httpChecker) Check(ctx context.Context) error {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type execChecker struct {
+	command string
+	args    []string
+}
+
+func (c *execChecker) Check(ctx context.Context) error {
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.command, c.args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInterval = 5 * time.Second
+	defaultTimeout  = 3 * time.Second
+	defaultFall     = 3
+	defaultRise     = 2
+)
+
+type check struct {
+	name    string
+	checker Checker
+}
+
+// Monitor 周期执行所有健康检查，连续失败 fall 次后标记为不健康，连续成功 rise 次后恢复
+type Monitor struct {
+	checks   []check
+	interval time.Duration
+	timeout  time.Duration
+	fall     int
+	rise     int
+
+	lock     sync.RWMutex
+	healthy  bool
+	failures int
+	success  int
+}
+
+func NewMonitor(c config.HealthCheckConfig) (*Monitor, error) {
+
+	m := &Monitor{
+		interval: time.Duration(c.Interval),
+		timeout:  time.Duration(c.Timeout),
+		fall:     c.Fall,
+		rise:     c.Rise,
+		healthy:  true,
+	}
+
+	if m.interval <= 0 {
+		m.interval = defaultInterval
+	}
+	if m.timeout <= 0 {
+		m.timeout = defaultTimeout
+	}
+	if m.fall <= 0 {
+		m.fall = defaultFall
+	}
+	if m.rise <= 0 {
+		m.rise = defaultRise
+	}
+
+	for i, cc := range c.Checks {
+		checker, err := NewChecker(cc)
+		if err != nil {
+			return nil, err
+		}
+		name := cc.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", cc.Type, i)
+		}
+		m.checks = append(m.checks, check{name: name, checker: checker})
+	}
+
+	return m, nil
+}
+
+// Healthy 返回当前健康状态，没有配置检查项时始终健康
+func (m *Monitor) Healthy() bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.healthy
+}
+
+func (m *Monitor) Interval() time.Duration { return m.interval }
+
+func (m *Monitor) Run(ctx context.Context) {
+
+	if len(m.checks) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.update(m.runChecks(ctx))
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Monitor) runChecks(ctx context.Context) bool {
+
+	passed := true
+	for _, c := range m.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		err := c.checker.Check(checkCtx)
+		cancel()
+		if err != nil {
+			log.WithError(err).WithField("check", c.name).Debug("Health check failure")
+			passed = false
+		}
+	}
+	return passed
+}
+
+func (m *Monitor) update(passed bool) {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if passed {
+		m.failures = 0
+		m.success++
+	} else {
+		m.success = 0
+		m.failures++
+	}
+
+	switch {
+	case m.healthy && m.failures >= m.fall:
+		m.healthy = false
+		log.WithField("failures", m.failures).Warn("Health check turn to unhealthy")
+	case !m.healthy && m.success >= m.rise:
+		m.healthy = true
+		log.WithField("success", m.success).Info("Health check turn to healthy")
+	}
+}
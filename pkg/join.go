@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/client"
+	"github.com/QQGoblin/veteran/pkg/tlsutil"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	joinTimeout       = 5 * time.Minute
+	joinRetryInterval = 2 * time.Second
+	joinAPITimeout    = 5 * time.Second
+)
+
+// join 请求 leader 将当前节点添加到集群，并等待当前节点出现在集群配置中
+func (v *Veteran) join() error {
+
+	isMember, err := v.core.IsMember()
+	if err != nil {
+		return err
+	}
+	if isMember {
+		return nil
+	}
+
+	c, err := v.memberClient(v.config.Join)
+	if err != nil {
+		return err
+	}
+
+	var priority *int
+	if v.config.Preempt.Priority != 0 {
+		priority = &v.config.Preempt.Priority
+	}
+
+	address := v.core.Address()
+	deadline := time.Now().Add(joinTimeout)
+	added := false
+
+	for time.Now().Before(deadline) {
+
+		if !added {
+			if err = v.learnMembers(c); err != nil {
+				log.WithError(err).Warn("Get cluster members failure, retry later")
+				time.Sleep(joinRetryInterval)
+				continue
+			}
+			if err = c.AddMember(v.config.ID, address, v.config.APIAddress(), false, priority); err != nil {
+				log.WithError(err).WithFields(log.Fields{"id": v.config.ID, "address": address}).Warn("Join cluster failure, retry later")
+			} else {
+				log.WithFields(log.Fields{"id": v.config.ID, "address": address}).Info("Join request accepted by leader")
+				added = true
+			}
+		}
+
+		if isMember, err = v.core.IsMember(); err != nil {
+			return err
+		}
+		if isMember {
+			log.WithField("id", v.config.ID).Info("Join cluster success")
+			return nil
+		}
+
+		time.Sleep(joinRetryInterval)
+	}
+
+	return fmt.Errorf("join cluster timeout after %s", joinTimeout)
+}
+
+// learnMembers 记录已有集群的成员，收到集群配置前 raft_tls 根据这些成员校验 leader 的证书
+func (v *Veteran) learnMembers(c *client.Client) error {
+
+	state, err := c.Status()
+	if err != nil {
+		return err
+	}
+	v.core.AddKnownServers(state.Members)
+	return nil
+}
+
+// memberClient 创建成员之间调用 api 的客户端，使用 member_token 认证，配置 api_tls 时使用当前节点的 api 证书作为客户端证书
+func (v *Veteran) memberClient(endpoints []string) (*client.Client, error) {
+
+	options := client.Options{Timeout: joinAPITimeout, Token: v.config.MemberToken}
+	if v.config.APITLS.Enabled() {
+		var err error
+		if options.TLS, err = tlsutil.ClientConfig(v.config.APITLS.TLSConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return client.New(endpoints, options)
+}
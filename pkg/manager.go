@@ -3,9 +3,13 @@ package pkg
 import (
 	"context"
 	"fmt"
+	"github.com/QQGoblin/veteran/pkg/client"
 	"github.com/QQGoblin/veteran/pkg/config"
 	"github.com/QQGoblin/veteran/pkg/consensus"
+	"github.com/QQGoblin/veteran/pkg/events"
+	"github.com/QQGoblin/veteran/pkg/health"
 	logutils "github.com/QQGoblin/veteran/pkg/log"
+	"github.com/QQGoblin/veteran/pkg/metrics"
 	"github.com/QQGoblin/veteran/pkg/plugins"
 	"github.com/hashicorp/raft"
 	"github.com/pkg/errors"
@@ -15,16 +19,28 @@ import (
 	"time"
 )
 
+const observerBuffer = 16
+
 type Veteran struct {
 	config        *config.VeteranConfig
 	core          *consensus.Manager
+	health        *health.Monitor
 	srv           *http.Server
+	streamCtx     context.Context
+	healthCancel  context.CancelFunc
+	stateCancel   context.CancelFunc
+	eventsCancel  context.CancelFunc
 	pluginsCancel map[string]context.CancelFunc
 }
 
 func NewVeteran(c *config.VeteranConfig) (*Veteran, error) {
 
-	core, err := consensus.NewManager(c.ID, c.InitPeers, c.Store)
+	core, err := consensus.NewManager(c)
+	if err != nil {
+		return nil, err
+	}
+
+	monitor, err := health.NewMonitor(c.Health)
 	if err != nil {
 		return nil, err
 	}
@@ -32,6 +48,7 @@ func NewVeteran(c *config.VeteranConfig) (*Veteran, error) {
 	return &Veteran{
 		config:        c,
 		core:          core,
+		health:        monitor,
 		pluginsCancel: make(map[string]context.CancelFunc),
 	}, nil
 }
@@ -39,7 +56,16 @@ func NewVeteran(c *config.VeteranConfig) (*Veteran, error) {
 func (v *Veteran) Start() error {
 
 	// 初始化 API Server
-	v.srv = v.apiServer()
+	srv, err := v.apiServer()
+	if err != nil {
+		return err
+	}
+	v.srv = srv
+
+	// 将 raft 内部指标输出到 /metrics
+	if err := metrics.EnableRaftMetrics("veteran"); err != nil {
+		return err
+	}
 
 	// 初始化 Raft
 	logOutput := io.Discard
@@ -47,16 +73,43 @@ func (v *Veteran) Start() error {
 		logOutput = logutils.RotateLogOutput(v.config.RaftLog.Output)
 	}
 
+	v.core.SetProgressReader(&progressReader{v: v, clients: make(map[string]*client.Client)})
 	if err := v.core.InitRaft(logOutput, v.config.RaftLog.Level); err != nil {
 		return err
 	}
 
+	// 首次启动时加入已有集群
+	if len(v.config.Join) != 0 {
+		if err := v.join(); err != nil {
+			return err
+		}
+	}
+
 	if err := v.initObserver(); err != nil {
 		return err
 	}
 
+	// 初始化健康检查
+	if len(v.config.Health.Checks) != 0 {
+		var ctx context.Context
+		ctx, v.healthCancel = context.WithCancel(context.Background())
+		go v.health.Run(ctx)
+		v.core.WatchHealth(v.health, v.health.Interval())
+	}
+
+	// 通告当前节点的健康状态
+	var stateCtx context.Context
+	stateCtx, v.stateCancel = context.WithCancel(context.Background())
+	go v.runMemberState(stateCtx)
+
 	go func() {
-		if err := v.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if v.srv.TLSConfig != nil {
+			err = v.srv.ListenAndServeTLS("", "")
+		} else {
+			err = v.srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.WithError(err).Fatal("Start api server failure")
 		}
 	}()
@@ -68,6 +121,15 @@ func (v *Veteran) Start() error {
 
 func (v *Veteran) Stop() {
 
+	// 先转移 leader，使 VIP 尽快漂移到其他节点，而不是等待选举超时，单个 voter 的集群没有可以转移的目标
+	if v.core.IsLeader() && v.core.HasOtherVoters() {
+		if err := v.core.TransferLeadership(""); err != nil {
+			log.WithError(err).Warn("Transfer leadership before stop failure")
+		} else {
+			log.Info("Transfer leadership before stop success")
+		}
+	}
+
 	if v.srv != nil {
 		ctxWithTimeout, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 		_ = v.srv.Shutdown(ctxWithTimeout)
@@ -78,11 +140,55 @@ func (v *Veteran) Stop() {
 		pluginCancel()
 	}
 
+	if v.healthCancel != nil {
+		v.healthCancel()
+	}
+
+	if v.stateCancel != nil {
+		v.stateCancel()
+	}
+
+	if v.eventsCancel != nil {
+		v.eventsCancel()
+	}
+
 	v.core.Shutdown()
 
 	log.Info("Stopped")
 }
 
+// Reload 重新加载配置中支持动态修改的部分，其余配置需要重启后生效
+func (v *Veteran) Reload(c *config.VeteranConfig) error {
+
+	level, err := log.ParseLevel(c.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	if err = v.core.SetLogLevel(c.RaftLog.Level); err != nil {
+		return err
+	}
+
+	log.SetLevel(level)
+	v.config.LogLevel = c.LogLevel
+	v.config.RaftLog.Level = c.RaftLog.Level
+	v.config.Raw = c.Raw
+
+	for name, plugin := range plugins.Plugins {
+		reloader, ok := plugin.(plugins.Reloader)
+		if !ok {
+			continue
+		}
+		if err = reloader.Reload(v.config); err != nil {
+			log.WithError(err).WithField("name", name).Error("Reload plugin failure")
+		}
+	}
+
+	log.Info("Reloaded")
+
+	return nil
+}
+
 func (v *Veteran) initObserver() error {
 
 	if v.core.Raft == nil {
@@ -90,9 +196,13 @@ func (v *Veteran) initObserver() error {
 	}
 
 	for name, plugin := range plugins.Plugins {
-		observationChan := make(chan raft.Observation)
+		// raft 发送 observation 时不会阻塞，插件处理较慢时使用缓冲避免丢弃
+		observationChan := make(chan raft.Observation, observerBuffer)
 		ctx, cancel := context.WithCancel(context.Background())
 		v.pluginsCancel[name] = cancel
+		if s, ok := plugin.(plugins.StepDowner); ok {
+			s.SetStepDown(v.core.StepDown)
+		}
 		if err := plugin.Setup(v.config); err != nil {
 			log.WithError(err).WithField("name", name).Fatal("Setup plugin failure")
 		}
@@ -100,5 +210,21 @@ func (v *Veteran) initObserver() error {
 		plugins.StartPlugin(ctx, observationChan, plugin)
 	}
 
+	// 将 raft 事件发布到 /events
+	observationChan := make(chan raft.Observation, observerBuffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	v.eventsCancel = cancel
+	v.core.Raft.RegisterObserver(raft.NewObserver(observationChan, false, events.Filter))
+	go func() {
+		for {
+			select {
+			case observation := <-observationChan:
+				events.PublishObservation(&observation)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	return nil
 }
@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/client"
+	"github.com/QQGoblin/veteran/pkg/consensus"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const memberStateInterval = 2 * time.Second
+
+// memberPublisher 写入成员状态，leader 直接写入 FSM，follower 通过 leader 的 api 写入
+type memberPublisher interface {
+	SetMemberState(id string, state consensus.MemberState) error
+	SetPriority(id string, priority int) error
+}
+
+// runMemberState 周期将当前节点的健康状态、nopreempt 以及优先级通告给集群，
+// leader 据此选择转移目标、决定是否抢占，并将不健康的 voter 降级为 non-voter
+func (v *Veteran) runMemberState(ctx context.Context) {
+
+	ticker := time.NewTicker(memberStateInterval)
+	defer ticker.Stop()
+
+	var (
+		c         *client.Client
+		endpoints string
+	)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		// 主动让出 leader 后的一段时间内保持不健康
+		state := consensus.MemberState{Healthy: v.health.Healthy() && !v.core.SteppedDown(), NoPreempt: v.config.Preempt.NoPreempt}
+		publishState := v.core.MemberState(v.config.ID) != state
+		// 只在集群中没有记录时写入配置的优先级，不覆盖通过 api 设置的值
+		publishPriority := v.config.Preempt.Priority != 0 && !v.core.HasPriority(v.config.ID)
+		if !publishState && !publishPriority {
+			continue
+		}
+
+		var publisher memberPublisher = v.core
+		if !v.core.IsLeader() {
+			addresses := make([]string, 0)
+			for _, address := range v.core.APIAddresses() {
+				addresses = append(addresses, address)
+			}
+			if len(addresses) == 0 {
+				continue
+			}
+			sort.Strings(addresses)
+
+			// 成员 api 地址变化时重新创建客户端
+			if current := strings.Join(addresses, ","); c == nil || current != endpoints {
+				var err error
+				if c, err = v.memberClient(addresses); err != nil {
+					log.WithError(err).Warn("Create member client failure")
+					continue
+				}
+				endpoints = current
+			}
+			publisher = c
+		}
+
+		if publishState {
+			if err := publisher.SetMemberState(v.config.ID, state); err != nil {
+				log.WithError(err).WithFields(log.Fields{"healthy": state.Healthy, "nopreempt": state.NoPreempt}).Warn("Publish member state failure")
+			}
+		}
+		if publishPriority {
+			if err := publisher.SetPriority(v.config.ID, v.config.Preempt.Priority); err != nil {
+				log.WithError(err).WithField("priority", v.config.Preempt.Priority).Warn("Publish priority failure")
+			}
+		}
+	}
+}
+
+// progressReader 通过成员的 /status 读取其最新日志索引，供 autopilot 判断 non-voter 是否追上 leader
+type progressReader struct {
+	v       *Veteran
+	lock    sync.Mutex
+	clients map[string]*client.Client
+}
+
+func (r *progressReader) LastIndex(memberID, apiAddress string) (uint64, error) {
+
+	r.lock.Lock()
+	c, ok := r.clients[apiAddress]
+	if !ok {
+		var err error
+		if c, err = r.v.memberClient([]string{apiAddress}); err != nil {
+			r.lock.Unlock()
+			return 0, err
+		}
+		r.clients[apiAddress] = c
+	}
+	r.lock.Unlock()
+
+	state, err := c.Status()
+	if err != nil {
+		return 0, err
+	}
+	if state.ID != memberID {
+		return 0, fmt.Errorf("api address %s belongs to %s", apiAddress, state.ID)
+	}
+	return state.LastIndex, nil
+}
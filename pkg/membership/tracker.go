@@ -0,0 +1,80 @@
+package membership
+
+import (
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+// Change 是集群配置中成员的变化
+type Change struct {
+	Server  raft.Server
+	Removed bool
+}
+
+// Tracker 记录上一次看到的集群配置，根据配置的差异生成成员加入/删除事件。
+// raft 的 PeerObservation 只表示 leader 开始/停止向成员复制日志，每次选举都会对所有成员重新发出，不能直接作为成员变化
+type Tracker struct {
+	lock    sync.Mutex
+	index   uint64
+	members map[raft.ServerID]raft.Server
+}
+
+// Reset 使用 index 对应的集群配置作为基准，不生成变化，index 不大于已记录的索引时忽略
+func (t *Tracker) Reset(index uint64, servers []raft.Server) {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if index <= t.index && t.members != nil {
+		return
+	}
+	t.index = index
+	t.members = toMap(servers)
+}
+
+// Store 记录 index 对应的集群配置并返回与上一次相比的变化。
+// index 不大于已记录的索引时忽略，例如重启后重放的配置日志；还没有成员时只记录配置，例如第一次收到配置的新成员
+func (t *Tracker) Store(index uint64, servers []raft.Server) []Change {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if index <= t.index && t.members != nil {
+		return nil
+	}
+	t.index = index
+	return t.diff(servers)
+}
+
+func (t *Tracker) diff(servers []raft.Server) []Change {
+
+	current := toMap(servers)
+	previous := t.members
+	t.members = current
+	if len(previous) == 0 {
+		return nil
+	}
+
+	var changes []Change
+	for _, server := range servers {
+		if _, ok := previous[server.ID]; !ok {
+			changes = append(changes, Change{Server: server})
+		}
+	}
+	for id, server := range previous {
+		if _, ok := current[id]; !ok {
+			changes = append(changes, Change{Server: server, Removed: true})
+		}
+	}
+	return changes
+}
+
+func toMap(servers []raft.Server) map[raft.ServerID]raft.Server {
+
+	result := make(map[raft.ServerID]raft.Server, len(servers))
+	for _, server := range servers {
+		result[server.ID] = server
+	}
+	return result
+}
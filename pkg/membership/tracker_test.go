@@ -0,0 +1,92 @@
+package membership
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func servers(ids ...string) []raft.Server {
+	result := make([]raft.Server, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, raft.Server{ID: raft.ServerID(id), Address: raft.ServerAddress(id + ":27010")})
+	}
+	return result
+}
+
+func TestTrackerStore(t *testing.T) {
+
+	tracker := &Tracker{}
+
+	// 还没有成员时只记录配置
+	if changes := tracker.Store(1, nil); len(changes) != 0 {
+		t.Fatalf("expected no changes on empty configuration, got %v", changes)
+	}
+	if changes := tracker.Store(2, servers("a", "b")); len(changes) != 0 {
+		t.Fatalf("expected no changes on first configuration, got %v", changes)
+	}
+
+	tests := []struct {
+		name    string
+		index   uint64
+		servers []raft.Server
+		want    []Change
+	}{
+		{
+			name:    "unchanged",
+			index:   3,
+			servers: servers("b", "a"),
+		},
+		{
+			name:    "member joined",
+			index:   4,
+			servers: servers("a", "b", "c"),
+			want:    []Change{{Server: servers("c")[0]}},
+		},
+		{
+			// 重启后重放的旧配置
+			name:    "replayed",
+			index:   2,
+			servers: servers("a", "b"),
+		},
+		{
+			name:    "member removed",
+			index:   5,
+			servers: servers("a", "c"),
+			want:    []Change{{Server: servers("b")[0], Removed: true}},
+		},
+		{
+			name:    "member replaced",
+			index:   6,
+			servers: servers("a", "d"),
+			want:    []Change{{Server: servers("d")[0]}, {Server: servers("c")[0], Removed: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		changes := tracker.Store(tt.index, tt.servers)
+		sort.SliceStable(changes, func(i, j int) bool { return !changes[i].Removed && changes[j].Removed })
+		if !reflect.DeepEqual(changes, tt.want) {
+			t.Fatalf("%s: expected changes %v, got %v", tt.name, tt.want, changes)
+		}
+	}
+}
+
+func TestTrackerReset(t *testing.T) {
+
+	tracker := &Tracker{}
+
+	// 启动时使用最新配置作为基准，重放的旧配置不会生成变化
+	tracker.Reset(5, servers("a", "b", "c"))
+	if changes := tracker.Store(3, servers("a", "b")); len(changes) != 0 {
+		t.Fatalf("expected replayed configuration to be ignored, got %v", changes)
+	}
+
+	changes := tracker.Store(6, servers("a", "b"))
+	want := []Change{{Server: servers("c")[0], Removed: true}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("expected changes %v, got %v", want, changes)
+	}
+}
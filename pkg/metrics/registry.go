@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	// Registry 保存 veteran 以及 raft 的所有指标，通过 /metrics 输出
+	Registry = prometheus.NewRegistry()
+
+	collectorsLock sync.Mutex
+	collectFuncs   []func()
+)
+
+// RegisterCollector 注册在输出指标前执行的函数，用于更新需要实时计算的指标
+func RegisterCollector(collector func()) {
+	collectorsLock.Lock()
+	defer collectorsLock.Unlock()
+	collectFuncs = append(collectFuncs, collector)
+}
+
+// Handler 以 prometheus 格式输出所有指标，包括 raft 通过 go-metrics 上报的指标
+func Handler() http.Handler {
+
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		collectorsLock.Lock()
+		funcs := append([]func(){}, collectFuncs...)
+		collectorsLock.Unlock()
+
+		for _, collect := range funcs {
+			collect()
+		}
+		return Registry.Gather()
+	})
+
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
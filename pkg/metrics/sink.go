@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	gometrics "github.com/armon/go-metrics"
+	gmprometheus "github.com/armon/go-metrics/prometheus"
+)
+
+var (
+	contacts    = &contactSink{peers: make(map[string]time.Time)}
+	contactKeys = []string{"raft.replication.heartbeat", "raft.replication.appendEntries.rpc"}
+)
+
+// EnableRaftMetrics 将 go-metrics 的全局输出设置为 prometheus，raft 内部指标通过 /metrics 输出
+func EnableRaftMetrics(service string) error {
+
+	c := gometrics.DefaultConfig(service)
+	c.EnableHostname = false
+	c.EnableHostnameLabel = false
+	c.EnableRuntimeMetrics = false
+
+	sink, err := gmprometheus.NewPrometheusSinkFrom(gmprometheus.PrometheusOpts{Name: service, Registerer: Registry})
+	if err != nil {
+		return err
+	}
+
+	_, err = gometrics.NewGlobal(c, gometrics.FanoutSink{sink, contacts})
+	return err
+}
+
+// LastContact 返回 leader 最近一次与 follower 成功通信的时间，来自 raft 上报的每个成员的复制指标
+func LastContact(peer string) time.Time {
+
+	contacts.lock.RLock()
+	defer contacts.lock.RUnlock()
+
+	return contacts.peers[peer]
+}
+
+// contactSink 记录 raft 每个成员的心跳、AppendEntries 指标的上报时间。
+// raft 只在请求成功后上报这些指标，上报时间即 leader 最近一次与成员成功通信的时间
+type contactSink struct {
+	gometrics.BlackholeSink
+	lock  sync.RWMutex
+	peers map[string]time.Time
+}
+
+func (s *contactSink) AddSampleWithLabels(key []string, _ float32, labels []gometrics.Label) {
+
+	if !isReplicationKey(key) {
+		return
+	}
+
+	for _, label := range labels {
+		if label.Name != "peer_id" {
+			continue
+		}
+		s.lock.Lock()
+		s.peers[label.Value] = time.Now()
+		s.lock.Unlock()
+	}
+}
+
+// isReplicationKey 匹配 raft.replication.heartbeat 以及 raft.replication.appendEntries.rpc，key 的第一段为 service 名称
+func isReplicationKey(key []string) bool {
+
+	for _, suffix := range contactKeys {
+		if len(key) < len(suffix) {
+			continue
+		}
+		if strings.Join(key[len(key)-len(suffix):], ".") == suffix {
+			return true
+		}
+	}
+	return false
+}
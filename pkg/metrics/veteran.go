@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	IsLeader = prometheus.NewGauge(prometheus.GaugeOpts{Name: "veteran_is_leader", Help: "Whether this node is the raft leader."})
+	Term     = prometheus.NewGauge(prometheus.GaugeOpts{Name: "veteran_raft_term", Help: "Current raft term."})
+
+	PeerLastContact      = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "veteran_peer_last_contact_seconds", Help: "Seconds since the leader last contacted the follower."}, []string{"peer"})
+	PeerFailedHeartbeats = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "veteran_peer_failed_heartbeats_total", Help: "Failed heartbeats from the leader to the follower."}, []string{"peer"})
+
+	VirtualIPOperations = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "veteran_virtual_ip_operations_total", Help: "Virtual ip add/delete operations."}, []string{"address", "operation"})
+	VirtualIPFailures   = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "veteran_virtual_ip_failures_total", Help: "Failed virtual ip add/delete operations."}, []string{"address", "operation"})
+
+	PluginHandlerDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: "veteran_plugin_handler_duration_seconds", Help: "Time spent in plugin handlers."}, []string{"plugin"})
+	PluginHandlerErrors   = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "veteran_plugin_handler_errors_total", Help: "Plugin handler errors."}, []string{"plugin"})
+
+	EventsDropped = prometheus.NewCounter(prometheus.CounterOpts{Name: "veteran_events_dropped_total", Help: "Events dropped because a subscriber was too slow."})
+)
+
+func init() {
+	Registry.MustRegister(
+		IsLeader,
+		Term,
+		PeerLastContact,
+		PeerFailedHeartbeats,
+		VirtualIPOperations,
+		VirtualIPFailures,
+		PluginHandlerDuration,
+		PluginHandlerErrors,
+		EventsDropped,
+	)
+}
@@ -0,0 +1,262 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/config"
+	"github.com/QQGoblin/veteran/pkg/events"
+	"github.com/hashicorp/raft"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	Name = "hooks"
+)
+
+const (
+	EventBecomeLeader    = "become_leader"
+	EventLoseLeader      = "lose_leader"
+	EventMemberJoined    = events.TypeMemberJoined
+	EventMemberRemoved   = events.TypeMemberRemoved
+	EventHeartbeatFailed = events.TypeHeartbeatFailed
+
+	PolicyIgnore   = "ignore"
+	PolicyRetry    = "retry"
+	PolicyStepDown = "step_down"
+
+	defaultTimeout  = 30 * time.Second
+	defaultRetries  = 3
+	retryInterval   = time.Second
+	queueSize       = 64
+	shutdownTimeout = 3 * time.Second
+)
+
+// Hooks 订阅集群事件并按顺序执行脚本，成员变化以及心跳失败与 /events 使用同一个事件来源，所有成员上都会触发
+type Hooks struct {
+	id       string
+	hooks    []hookConfig
+	leader   bool
+	stepDown func(reason string) error
+	consumer *events.Consumer
+	lock     sync.Mutex
+}
+
+type hookConfig struct {
+	Event         string          `json:"event"`
+	Command       string          `json:"command"`
+	Args          []string        `json:"args"`
+	Timeout       config.Duration `json:"timeout"`
+	FailurePolicy string          `json:"failure_policy"` // ignore、retry 或 step_down，默认 ignore
+	Retries       int             `json:"retries"`        // failure_policy 为 retry 时的重试次数，默认 3
+}
+
+type event struct {
+	name string
+	env  map[string]string
+}
+
+// SetStepDown 设置 step_down 策略让出 leader 的方式，需要在 Setup 之前调用
+func (p *Hooks) SetStepDown(stepDown func(reason string) error) {
+	p.stepDown = stepDown
+}
+
+func (p *Hooks) Setup(veteranC *config.VeteranConfig) error {
+
+	p.id = veteranC.ID
+
+	if err := p.Reload(veteranC); err != nil {
+		return err
+	}
+
+	p.consumer = events.Consume(queueSize, p.handle)
+
+	return nil
+}
+
+func (p *Hooks) Reload(veteranC *config.VeteranConfig) error {
+
+	hooks, err := parseConfig(veteranC)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	p.hooks = hooks
+	p.lock.Unlock()
+
+	return nil
+}
+
+func parseConfig(veteranC *config.VeteranConfig) ([]hookConfig, error) {
+
+	tempConfig := struct {
+		C []hookConfig `json:"hooks"`
+	}{}
+
+	if err := json.Unmarshal(veteranC.Raw, &tempConfig); err != nil {
+		return nil, err
+	}
+
+	for i, h := range tempConfig.C {
+		switch h.Event {
+		case EventBecomeLeader, EventLoseLeader, EventMemberJoined, EventMemberRemoved, EventHeartbeatFailed:
+		default:
+			return nil, fmt.Errorf("unknown hook event %q", h.Event)
+		}
+
+		switch h.FailurePolicy {
+		case "":
+			tempConfig.C[i].FailurePolicy = PolicyIgnore
+		case PolicyIgnore, PolicyRetry, PolicyStepDown:
+		default:
+			return nil, fmt.Errorf("unknown hook failure policy %q", h.FailurePolicy)
+		}
+
+		if h.Command == "" {
+			return nil, fmt.Errorf("hook %s command is empty", h.Event)
+		}
+		if h.Timeout <= 0 {
+			tempConfig.C[i].Timeout = config.Duration(defaultTimeout)
+		}
+		if h.Retries <= 0 {
+			tempConfig.C[i].Retries = defaultRetries
+		}
+	}
+
+	return tempConfig.C, nil
+}
+
+// Handler 不处理 raft observation，事件通过 events 订阅
+func (p *Hooks) Handler(*raft.Observation) error {
+	return nil
+}
+
+// toEvent 将集群事件转换为 hook 事件，不关心的事件返回 nil
+func (p *Hooks) toEvent(e events.Event) *event {
+
+	result := &event{name: e.Type, env: map[string]string{"VETERAN_NODE_ID": p.id}}
+	switch e.Type {
+	case events.TypeLeader:
+		result.env["VETERAN_LEADER_ID"] = e.Fields["leader_id"]
+		result.env["VETERAN_LEADER_ADDRESS"] = e.Fields["leader_address"]
+		wasLeader := p.leader
+		p.leader = e.Fields["leader_id"] == p.id
+		switch {
+		case p.leader && !wasLeader:
+			result.name = EventBecomeLeader
+		case !p.leader && wasLeader:
+			result.name = EventLoseLeader
+		default:
+			return nil
+		}
+	case events.TypeMemberJoined, events.TypeMemberRemoved:
+		result.env["VETERAN_PEER_ID"] = e.Fields["id"]
+		result.env["VETERAN_PEER_ADDRESS"] = e.Fields["address"]
+	case events.TypeHeartbeatFailed:
+		result.env["VETERAN_PEER_ID"] = e.Fields["id"]
+		result.env["VETERAN_LAST_CONTACT"] = e.Fields["last_contact"]
+	default:
+		return nil
+	}
+	return result
+}
+
+func (p *Hooks) handle(_ context.Context, e events.Event) {
+
+	hookEvent := p.toEvent(e)
+	if hookEvent == nil {
+		return
+	}
+
+	p.lock.Lock()
+	hooks := p.hooks
+	p.lock.Unlock()
+
+	for _, h := range hooks {
+		if h.Event != hookEvent.name {
+			continue
+		}
+
+		err := p.execute(h, hookEvent)
+		if err == nil || h.FailurePolicy != PolicyStepDown || p.stepDown == nil || !p.leader {
+			continue
+		}
+
+		// 脚本失败时主动让出 leader，并在一段时间内通告当前节点不健康，避免被优先级抢占转移回来
+		log.WithError(err).WithFields(log.Fields{"name": Name, "event": hookEvent.name, "command": h.Command}).Warn("[Plugin] hook failed, step down")
+		reason := fmt.Sprintf("hook %s %s failed", hookEvent.name, h.Command)
+		if err = p.stepDown(reason); err != nil && !errors.Is(err, raft.ErrNotLeader) {
+			log.WithError(err).WithField("name", Name).Error("[Plugin] step down failed")
+		}
+	}
+}
+
+func (p *Hooks) execute(h hookConfig, e *event) error {
+
+	attempts := 1
+	if h.FailurePolicy == PolicyRetry {
+		attempts += h.Retries
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(retryInterval)
+		}
+		if err = p.exec(h, e); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (p *Hooks) exec(h hookConfig, e *event) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.Timeout))
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.Env = append(os.Environ(), "VETERAN_EVENT="+e.name)
+	for k, v := range e.env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	err := cmd.Run()
+	fields := log.Fields{"name": Name, "event": e.name, "command": h.Command, "output": strings.TrimSpace(output.String())}
+	if err != nil {
+		log.WithError(err).WithFields(fields).Error("[Plugin] hook failed")
+		return err
+	}
+
+	log.WithFields(fields).Info("[Plugin] hook success")
+	return nil
+}
+
+func (p *Hooks) Shutdown() error {
+
+	if p.consumer == nil {
+		return nil
+	}
+
+	// 等待正在执行的脚本结束，未执行的事件会被丢弃
+	p.consumer.Stop(shutdownTimeout)
+	return nil
+}
+
+func (p *Hooks) Name() string { return Name }
+
+// Filter 不订阅 raft observation，事件通过 events 订阅
+func (p *Hooks) Filter(*raft.Observation) bool {
+	return false
+}
@@ -3,10 +3,15 @@ package plugins
 import (
 	"context"
 	"github.com/QQGoblin/veteran/pkg/config"
+	"github.com/QQGoblin/veteran/pkg/events"
+	"github.com/QQGoblin/veteran/pkg/metrics"
+	"github.com/QQGoblin/veteran/pkg/plugins/hooks"
 	"github.com/QQGoblin/veteran/pkg/plugins/metadata"
 	"github.com/QQGoblin/veteran/pkg/plugins/virtualip"
+	"github.com/QQGoblin/veteran/pkg/plugins/webhook"
 	"github.com/hashicorp/raft"
 	log "github.com/sirupsen/logrus"
+	"time"
 )
 
 var (
@@ -21,9 +26,21 @@ type Plugin interface {
 	Name() string
 }
 
+// Reloader 是插件的可选接口，实现后支持在不重启 raft 的情况下重新加载配置
+type Reloader interface {
+	Reload(config *config.VeteranConfig) error
+}
+
+// StepDowner 是插件的可选接口，实现后插件可以通过 stepDown 让当前节点主动让出 leader
+type StepDowner interface {
+	SetStepDown(stepDown func(reason string) error)
+}
+
 func init() {
 	Register(metadata.Name, &metadata.Metadata{})
 	Register(virtualip.Name, &virtualip.VirtualIP{})
+	Register(hooks.Name, &hooks.Hooks{})
+	Register(webhook.Name, &webhook.Webhook{})
 }
 
 func Register(name string, plugin Plugin) {
@@ -44,7 +61,12 @@ func StartPlugin(ctx context.Context, input chan raft.Observation, p Plugin) {
 		for {
 			select {
 			case observation := <-input:
-				if err := p.Handler(&observation); err != nil {
+				start := time.Now()
+				err := p.Handler(&observation)
+				metrics.PluginHandlerDuration.WithLabelValues(p.Name()).Observe(time.Since(start).Seconds())
+				if err != nil {
+					metrics.PluginHandlerErrors.WithLabelValues(p.Name()).Inc()
+					events.Publish(events.TypePluginError, err.Error(), map[string]string{"plugin": p.Name()})
 					log.WithError(err).WithField("name", p.Name()).Error("Plugin failed to run")
 				}
 			case <-ctx.Done():
@@ -1,100 +1,319 @@
 package virtualip
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/QQGoblin/veteran/pkg/config"
+	"github.com/QQGoblin/veteran/pkg/events"
+	"github.com/QQGoblin/veteran/pkg/metrics"
 	"github.com/QQGoblin/veteran/pkg/plugins/virtualip/network"
 	"github.com/hashicorp/raft"
 	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
 )
 
 var (
 	Name = "virtual_ip"
 )
 
+const (
+	refreshBurstGap = 200 * time.Millisecond
+	operationAdd    = "add"
+	operationDelete = "delete"
+)
+
 type VirtualIP struct {
-	id      raft.ServerID
+	id     raft.ServerID
+	vips   []*vip
+	leader bool // 最近一次处理事件时当前节点是否为 leader
+	lock   sync.Mutex
+}
+
+type vip struct {
+	config  virtualIPConfig
 	handler network.Configurator
+	stop    chan struct{} // 不为空时表示周期通告正在运行
 }
 
 type virtualIPConfig struct {
 	IFace   string `json:"iface"`
 	Address string `json:"address"`
+	// RefreshInterval 持有 VIP 期间重复发送 gratuitous arp/neighbor advertisement 的间隔，0 表示不重复发送
+	RefreshInterval config.Duration `json:"refresh_interval"`
+	// RefreshCount 每次重复通告时连续发送的次数
+	RefreshCount int `json:"refresh_count"`
 }
 
 func (p *VirtualIP) Setup(veteranC *config.VeteranConfig) error {
 
-	var err error
+	p.lock.Lock()
+	defer p.lock.Unlock()
 
 	p.id = raft.ServerID(veteranC.ID)
 
+	configs, err := parseConfig(veteranC)
+	if err != nil {
+		return err
+	}
+
+	p.vips = make([]*vip, 0, len(configs))
+	for _, c := range configs {
+		v, err := newVIP(c)
+		if err != nil {
+			return err
+		}
+		p.vips = append(p.vips, v)
+	}
+
+	return nil
+}
+
+// Reload 按新配置增删 VIP，当前节点是 leader 时删除旧地址并添加新地址，未变化的 VIP 不受影响
+func (p *VirtualIP) Reload(veteranC *config.VeteranConfig) error {
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	configs, err := parseConfig(veteranC)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[virtualIPConfig]*vip, len(p.vips))
+	for _, v := range p.vips {
+		current[v.config] = v
+	}
+
+	vips := make([]*vip, 0, len(configs))
+	for _, c := range configs {
+		if v, ok := current[c]; ok {
+			vips = append(vips, v)
+			delete(current, c)
+			continue
+		}
+		v, err := newVIP(c)
+		if err != nil {
+			return err
+		}
+		vips = append(vips, v)
+	}
+
+	var errs []error
+	for _, v := range current {
+		v.stopRefresh()
+		log.WithFields(log.Fields{"name": Name, "address": v.config.Address, "iface": v.config.IFace}).Info("[Plugin] remove virtual ip from config")
+		if err = v.handler.DeleteIP(); err != nil {
+			errs = append(errs, v.wrap(err))
+		}
+	}
+
+	p.vips = vips
+
+	if p.leader {
+		errs = append(errs, p.reconcile(true)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseConfig 兼容单个 {iface, address} 对象以及对象列表两种配置格式
+func parseConfig(veteranC *config.VeteranConfig) ([]virtualIPConfig, error) {
+
 	tempConfig := struct {
-		C virtualIPConfig `json:"virtual_ip"`
+		C json.RawMessage `json:"virtual_ip"`
 	}{}
 
-	if err = json.Unmarshal(veteranC.Raw, &tempConfig); err != nil {
-		return err
+	if err := json.Unmarshal(veteranC.Raw, &tempConfig); err != nil {
+		return nil, err
 	}
 
-	if tempConfig.C.IFace == "" || tempConfig.C.Address == "" {
-		return fmt.Errorf("parameter configuration is incorrect")
+	var configs []virtualIPConfig
+
+	raw := bytes.TrimSpace(tempConfig.C)
+	switch {
+	case len(raw) == 0:
+		return nil, fmt.Errorf("parameter configuration is incorrect")
+	case raw[0] == '[':
+		if err := json.Unmarshal(raw, &configs); err != nil {
+			return nil, err
+		}
+	default:
+		var c virtualIPConfig
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, err
+		}
+		configs = append(configs, c)
 	}
 
-	p.handler, err = network.NewAliasConfigurator(tempConfig.C.Address, tempConfig.C.IFace)
-	return err
+	addresses := make(map[string]struct{}, len(configs))
+	for i, c := range configs {
+		if c.RefreshCount == 0 {
+			configs[i].RefreshCount = 1
+		}
+		if c.IFace == "" || c.Address == "" || c.RefreshInterval < 0 || c.RefreshCount < 0 {
+			return nil, fmt.Errorf("parameter configuration is incorrect")
+		}
+		if _, ok := addresses[c.Address]; ok {
+			return nil, fmt.Errorf("duplicate virtual ip %s", c.Address)
+		}
+		addresses[c.Address] = struct{}{}
+	}
 
+	return configs, nil
+}
+
+func newVIP(c virtualIPConfig) (*vip, error) {
+
+	handler, err := network.NewAliasConfigurator(c.Address, c.IFace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vip{config: c, handler: handler}, nil
 }
 
 func (p *VirtualIP) Handler(observation *raft.Observation) error {
 
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	_, leader := observation.Raft.LeaderWithID()
 
-	isSetVirtualIP, err := p.handler.IsSet()
-	if err != nil {
-		return err
+	// 连接 leader 失败或当前不是 leader 时删除 VIP，当前是 leader 时添加 VIP
+	p.leader = leader != "" && leader == p.id
+
+	return errors.Join(p.reconcile(p.leader)...)
+}
+
+// reconcile 同时添加或删除所有 VIP，每个 VIP 的错误单独记录
+func (p *VirtualIP) reconcile(leader bool) []error {
+
+	var errs []error
+	for _, v := range p.vips {
+		if err := v.reconcile(leader); err != nil {
+			log.WithError(err).WithFields(log.Fields{"name": Name, "address": v.config.Address, "iface": v.config.IFace}).Error("[Plugin] virtual ip failed")
+			errs = append(errs, v.wrap(err))
+		}
+	}
+
+	return errs
+}
+
+func (v *vip) reconcile(leader bool) error {
+
+	if !leader {
+		v.stopRefresh()
 	}
 
-	// 1. 未设置 VIP, 连接 leader 失败
-	// 2. 未设置 VIP, 当前不是 leader
-	if !isSetVirtualIP && (leader == "" || leader != p.id) {
-		return nil
+	isSetVirtualIP, err := v.handler.IsSet()
+	if err != nil {
+		return err
 	}
 
-	// 3. 未设置 VIP, 当前是 leader
-	if !isSetVirtualIP && leader == p.id {
-		log.WithField("name", Name).Info("[Plugin] add virtual ip")
-		if err = p.handler.AddIP(); err != nil {
+	if !isSetVirtualIP && leader {
+		log.WithFields(log.Fields{"name": Name, "address": v.config.Address}).Info("[Plugin] add virtual ip")
+		if err = v.count(operationAdd, v.handler.AddIP()); err != nil {
 			return err
 		}
 	}
 
-	// 4. 设置 VIP, 当前是 leader
-	if isSetVirtualIP && leader == p.id {
-		return nil
+	if isSetVirtualIP && !leader {
+		log.WithFields(log.Fields{"name": Name, "address": v.config.Address}).Info("[Plugin] delete virtual ip")
+		return v.count(operationDelete, v.handler.DeleteIP())
 	}
 
-	// 5. 设置 VIP, 连接 leader 失败
-	// 6. 设置 VIP, 当前不是 leader
-	if isSetVirtualIP && (leader == "" || leader != p.id) {
-		log.WithField("name", Name).Info("[Plugin] delete virtual ip")
-		if err = p.handler.DeleteIP(); err != nil {
-			return err
-		}
+	if leader {
+		v.startRefresh()
 	}
 
 	return nil
+}
+
+// startRefresh 启动周期通告，避免首次通告丢失或交换机清空表项后流量仍发往旧节点
+func (v *vip) startRefresh() {
+
+	if v.config.RefreshInterval == 0 || v.stop != nil {
+		return
+	}
 
+	stop := make(chan struct{})
+	v.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(v.config.RefreshInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				v.announce(stop)
+			case <-stop:
+				return
+			}
+		}
+	}()
 }
 
-func (p *VirtualIP) Shutdown() error {
+func (v *vip) stopRefresh() {
+	if v.stop != nil {
+		close(v.stop)
+		v.stop = nil
+	}
+}
+
+func (v *vip) announce(stop chan struct{}) {
 
-	if err := p.handler.DeleteIP(); err != nil {
+	for i := 0; i < v.config.RefreshCount; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(refreshBurstGap):
+			case <-stop:
+				return
+			}
+		}
+		if err := v.handler.Announce(); err != nil {
+			log.WithError(err).WithFields(log.Fields{"name": Name, "address": v.config.Address, "iface": v.config.IFace}).Warn("[Plugin] refresh virtual ip failed")
+		}
+	}
+}
+
+// count 记录 VIP 操作次数以及失败次数，操作成功时发布事件
+func (v *vip) count(operation string, err error) error {
+	metrics.VirtualIPOperations.WithLabelValues(v.config.Address, operation).Inc()
+	if err != nil {
+		metrics.VirtualIPFailures.WithLabelValues(v.config.Address, operation).Inc()
 		return err
 	}
+
+	eventType := events.TypeVirtualIPAdded
+	if operation == operationDelete {
+		eventType = events.TypeVirtualIPDeleted
+	}
+	events.Publish(eventType, "", map[string]string{"address": v.config.Address, "iface": v.config.IFace})
 	return nil
 }
 
+func (v *vip) wrap(err error) error {
+	return fmt.Errorf("%s on %s: %w", v.config.Address, v.config.IFace, err)
+}
+
+func (p *VirtualIP) Shutdown() error {
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var errs []error
+	for _, v := range p.vips {
+		v.stopRefresh()
+		if err := v.handler.DeleteIP(); err != nil {
+			errs = append(errs, v.wrap(err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (p *VirtualIP) Name() string { return Name }
 
 func (p *VirtualIP) Filter(_ *raft.Observation) bool { return true }
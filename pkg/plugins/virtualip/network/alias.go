@@ -4,6 +4,8 @@ import (
 	"github.com/j-keck/arping"
 	"github.com/pkg/errors"
 	"github.com/vishvananda/netlink"
+	"net"
+	"syscall"
 )
 
 type AliasConfigurator struct {
@@ -20,6 +22,11 @@ func NewAliasConfigurator(address, iface string) (result AliasConfigurator, err
 		return
 	}
 
+	// IPv6 地址跳过 DAD，避免地址处于 tentative 状态时无法发送 neighbor advertisement
+	if addr.IP.To4() == nil {
+		addr.Flags |= syscall.IFA_F_NODAD
+	}
+
 	result = AliasConfigurator{iface: iface, address: addr}
 
 	result.link, err = netlink.LinkByName(iface)
@@ -47,8 +54,26 @@ func (configurator AliasConfigurator) AddIP() error {
 		return errors.Wrap(err, "could not add ip")
 	}
 
-	if err = arping.GratuitousArpOverIfaceByName(configurator.address.IP, configurator.iface); err != nil {
-		return errors.Wrap(err, "gratuitous arp failed")
+	return configurator.Announce()
+}
+
+// Announce 通告 VIP 对应的 mac 地址，IPv4 使用 gratuitous arp，IPv6 使用 unsolicited neighbor advertisement
+func (configurator AliasConfigurator) Announce() error {
+
+	if configurator.address.IP.To4() != nil {
+		if err := arping.GratuitousArpOverIfaceByName(configurator.address.IP, configurator.iface); err != nil {
+			return errors.Wrap(err, "gratuitous arp failed")
+		}
+		return nil
+	}
+
+	iface, err := net.InterfaceByName(configurator.iface)
+	if err != nil {
+		return errors.Wrapf(err, "could not get interface '%s'", configurator.iface)
+	}
+
+	if err = sendUnsolicitedNeighborAdvertisement(configurator.address.IP, iface); err != nil {
+		return errors.Wrap(err, "unsolicited neighbor advertisement failed")
 	}
 
 	return nil
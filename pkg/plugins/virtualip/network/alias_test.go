@@ -0,0 +1,252 @@
+//go:build linux
+
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+const (
+	testLink = "vip0"
+	testPeer = "peer0"
+	testVIP  = "fd00:10::10/64"
+)
+
+// setupNetns 在新的 network namespace 中创建一对 veth，测试结束后切换回原来的 namespace。
+// namespace 与线程绑定，测试中不能启动子测试或者在其他 goroutine 中操作网络
+func setupNetns(t *testing.T) (netlink.Link, netlink.Link) {
+	t.Helper()
+
+	if os.Geteuid() != 0 {
+		t.Skip("network namespace tests require root")
+	}
+
+	runtime.LockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		t.Fatalf("get current network namespace: %s", err)
+	}
+
+	ns, err := netns.New()
+	if err != nil {
+		_ = origin.Close()
+		runtime.UnlockOSThread()
+		t.Skipf("create network namespace: %s", err)
+	}
+
+	t.Cleanup(func() {
+		if err := netns.Set(origin); err != nil {
+			// 无法切换回原 namespace 时不能再复用该线程
+			t.Errorf("restore network namespace: %s", err)
+			return
+		}
+		_ = ns.Close()
+		_ = origin.Close()
+		runtime.UnlockOSThread()
+	})
+
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: testLink}, PeerName: testPeer}
+	if err = netlink.LinkAdd(veth); err != nil {
+		t.Fatalf("add veth: %s", err)
+	}
+
+	link, err := netlink.LinkByName(testLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := netlink.LinkByName(testPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range []netlink.Link{link, peer} {
+		if err = netlink.LinkSetUp(l); err != nil {
+			t.Fatalf("set %s up: %s", l.Attrs().Name, err)
+		}
+	}
+
+	return link, peer
+}
+
+func findAddr(t *testing.T, link netlink.Link, ip net.IP) *netlink.Addr {
+	t.Helper()
+
+	addresses, err := netlink.AddrList(link, netlink.FAMILY_V6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range addresses {
+		if addresses[i].IP.Equal(ip) {
+			return &addresses[i]
+		}
+	}
+	return nil
+}
+
+func TestAddIPv6SkipsDAD(t *testing.T) {
+
+	link, _ := setupNetns(t)
+
+	configurator, err := NewAliasConfigurator(testVIP, testLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = configurator.AddIP(); err != nil {
+		t.Fatalf("add ip: %s", err)
+	}
+
+	addr := findAddr(t, link, configurator.address.IP)
+	if addr == nil {
+		t.Fatalf("%s is not found on %s", testVIP, testLink)
+	}
+	if addr.Flags&syscall.IFA_F_NODAD == 0 {
+		t.Fatalf("expected IFA_F_NODAD on %s, flags %#x", testVIP, addr.Flags)
+	}
+	// tentative 地址无法作为源地址发送 neighbor advertisement
+	if addr.Flags&syscall.IFA_F_TENTATIVE != 0 {
+		t.Fatalf("%s is tentative, flags %#x", testVIP, addr.Flags)
+	}
+
+	// 重复添加不会报错
+	if err = configurator.AddIP(); err != nil {
+		t.Fatalf("add ip again: %s", err)
+	}
+
+	if err = configurator.DeleteIP(); err != nil {
+		t.Fatalf("delete ip: %s", err)
+	}
+	if set, err := configurator.IsSet(); err != nil || set {
+		t.Fatalf("expected ip deleted, set %v, error %v", set, err)
+	}
+}
+
+func TestAnnounceIPv6SendsUnsolicitedNeighborAdvertisement(t *testing.T) {
+
+	link, _ := setupNetns(t)
+
+	// 在 veth 另一端监听 icmpv6 报文
+	fd, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_RAW, syscall.IPPROTO_ICMPV6)
+	if err != nil {
+		t.Fatalf("open icmpv6 socket: %s", err)
+	}
+	defer syscall.Close(fd)
+
+	if err = syscall.SetsockoptString(fd, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, testPeer); err != nil {
+		t.Fatal(err)
+	}
+	if err = syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_RECVHOPLIMIT, 1); err != nil {
+		t.Fatal(err)
+	}
+	timeout := syscall.NsecToTimeval(int64(time.Second))
+	if err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		t.Fatal(err)
+	}
+
+	configurator, err := NewAliasConfigurator(testVIP, testLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// AddIP 添加地址后立即发送 neighbor advertisement
+	if err = configurator.AddIP(); err != nil {
+		t.Fatalf("add ip: %s", err)
+	}
+
+	vip := configurator.address.IP.To16()
+	mac := link.Attrs().HardwareAddr
+
+	deadline := time.Now().Add(5 * time.Second)
+	buf := make([]byte, 1500)
+	oob := make([]byte, 128)
+	for time.Now().Before(deadline) {
+		n, oobn, _, _, err := syscall.Recvmsg(fd, buf, oob, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			t.Fatalf("receive: %s", err)
+		}
+
+		// 忽略 router solicitation、MLD 等其他 icmpv6 报文
+		msg := buf[:n]
+		if len(msg) < 24 || msg[0] != icmpv6NeighborAdvertisement || !bytes.Equal(msg[8:24], vip) {
+			continue
+		}
+
+		if msg[4]&ndpOverrideFlag == 0 {
+			t.Fatalf("override flag is not set, flags %#x", msg[4])
+		}
+		if len(msg) < 32 || msg[24] != ndpOptTargetLinkLayerAddr || msg[25] != 1 {
+			t.Fatalf("target link-layer address option is not found: %x", msg)
+		}
+		if !bytes.Equal(msg[26:32], mac) {
+			t.Fatalf("expected target link-layer address %s, got %s", mac, net.HardwareAddr(msg[26:32]))
+		}
+		if hopLimit := receivedHopLimit(t, oob[:oobn]); hopLimit != ndpHopLimit {
+			t.Fatalf("expected hop limit %d, got %d", ndpHopLimit, hopLimit)
+		}
+		return
+	}
+
+	t.Fatal("unsolicited neighbor advertisement is not received")
+}
+
+func receivedHopLimit(t *testing.T, oob []byte) int {
+	t.Helper()
+
+	messages, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range messages {
+		if m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_HOPLIMIT && len(m.Data) >= 4 {
+			return int(int32(binary.NativeEndian.Uint32(m.Data)))
+		}
+	}
+	t.Fatal("hop limit is not found in control messages")
+	return 0
+}
+
+// TestIPv6DADKeepsAddressTentative 验证不设置 IFA_F_NODAD 时地址在 DAD 完成前处于 tentative 状态，
+// 此时无法发送 neighbor advertisement，这也是 AddIP 需要跳过 DAD 的原因
+func TestIPv6DADKeepsAddressTentative(t *testing.T) {
+
+	link, _ := setupNetns(t)
+
+	addr, err := netlink.ParseAddr(testVIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = netlink.AddrAdd(link, addr); err != nil {
+		t.Fatalf("add ip: %s", err)
+	}
+
+	found := findAddr(t, link, addr.IP)
+	if found == nil {
+		t.Fatalf("%s is not found on %s", testVIP, testLink)
+	}
+	if found.Flags&syscall.IFA_F_TENTATIVE == 0 {
+		t.Skipf("DAD is disabled on %s, flags %#x", testLink, found.Flags)
+	}
+
+	iface, err := net.InterfaceByName(testLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sendUnsolicitedNeighborAdvertisement(addr.IP, iface); err == nil {
+		t.Fatal("expected neighbor advertisement from tentative address to fail")
+	}
+}
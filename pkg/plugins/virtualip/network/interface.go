@@ -4,4 +4,5 @@ type Configurator interface {
 	AddIP() error
 	DeleteIP() error
 	IsSet() (bool, error)
+	Announce() error
 }
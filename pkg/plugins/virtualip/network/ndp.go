@@ -0,0 +1,62 @@
+package network
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	icmpv6NeighborAdvertisement = 136
+	ndpOverrideFlag             = 0x20
+	ndpOptTargetLinkLayerAddr   = 2
+	ndpHopLimit                 = 255
+)
+
+// sendUnsolicitedNeighborAdvertisement 向 ff02::1 发送 unsolicited neighbor advertisement（RFC 4861 7.2.6），
+// 设置 Override 标记使邻居更新 ip 对应的 mac 地址
+func sendUnsolicitedNeighborAdvertisement(ip net.IP, iface *net.Interface) error {
+
+	if len(iface.HardwareAddr) != 6 {
+		return errors.Errorf("interface '%s' has no ethernet address", iface.Name)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_RAW, syscall.IPPROTO_ICMPV6)
+	if err != nil {
+		return errors.Wrap(err, "could not open icmpv6 socket")
+	}
+	defer syscall.Close(fd)
+
+	// 邻居发现报文的 hop limit 必须是 255，否则会被接收方丢弃
+	if err = syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, ndpHopLimit); err != nil {
+		return errors.Wrap(err, "could not set hop limit")
+	}
+
+	if err = syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_IF, iface.Index); err != nil {
+		return errors.Wrap(err, "could not set multicast interface")
+	}
+
+	source := &syscall.SockaddrInet6{}
+	copy(source.Addr[:], ip.To16())
+	if err = syscall.Bind(fd, source); err != nil {
+		return errors.Wrapf(err, "could not bind to '%s'", ip)
+	}
+
+	// type(1) code(1) checksum(2) flags(4) target(16) option(8)，checksum 由内核计算
+	msg := make([]byte, 32)
+	msg[0] = icmpv6NeighborAdvertisement
+	msg[4] = ndpOverrideFlag
+	copy(msg[8:24], ip.To16())
+	msg[24] = ndpOptTargetLinkLayerAddr
+	msg[25] = 1
+	copy(msg[26:32], iface.HardwareAddr)
+
+	target := &syscall.SockaddrInet6{ZoneId: uint32(iface.Index)}
+	copy(target.Addr[:], net.IPv6linklocalallnodes)
+	if err = syscall.Sendto(fd, msg, 0, target); err != nil {
+		return errors.Wrap(err, "could not send neighbor advertisement")
+	}
+
+	return nil
+}
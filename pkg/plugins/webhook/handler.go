@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/config"
+	"github.com/QQGoblin/veteran/pkg/events"
+	"github.com/hashicorp/raft"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	Name = "webhook"
+)
+
+const (
+	signatureHeader = "X-Veteran-Signature"
+	signaturePrefix = "sha256="
+	contentTypeJSON = "application/json"
+
+	defaultTimeout   = 5 * time.Second
+	defaultRetries   = 3
+	defaultBackoff   = time.Second
+	defaultQueueSize = 100
+	maxBackoff       = 30 * time.Second
+	shutdownTimeout  = 3 * time.Second
+)
+
+// Webhook 订阅集群事件并发送给 endpoints，事件与 /events 推送的一致
+type Webhook struct {
+	id       string
+	config   webhookConfig
+	consumer *events.Consumer
+	lock     sync.RWMutex
+}
+
+type webhookConfig struct {
+	Endpoints []string        `json:"endpoints"`
+	Secret    string          `json:"secret"`  // 不为空时使用 HMAC-SHA256 对请求体签名
+	Events    []string        `json:"events"`  // 需要通知的事件，与 /events 的事件类型一致，为空时通知所有事件
+	Timeout   config.Duration `json:"timeout"` // 单次请求超时时间，默认 5s
+	Retries   int             `json:"retries"` // 失败后的重试次数，默认 3
+	Backoff   config.Duration `json:"backoff"` // 第一次重试的等待时间，之后每次翻倍，默认 1s
+	QueueSize int             `json:"queue_size"`
+}
+
+// Event 是发送给 webhook 的请求体，Node 为发送通知的成员
+type Event struct {
+	events.Event
+	Node string `json:"node"`
+}
+
+func (p *Webhook) Setup(veteranC *config.VeteranConfig) error {
+
+	p.id = veteranC.ID
+
+	c, err := parseConfig(veteranC)
+	if err != nil {
+		return err
+	}
+	p.config = c
+
+	// 有界队列，接收方较慢时丢弃事件而不是阻塞事件的发布方
+	p.consumer = events.Consume(c.QueueSize, p.deliver)
+
+	return nil
+}
+
+func (p *Webhook) Reload(veteranC *config.VeteranConfig) error {
+
+	c, err := parseConfig(veteranC)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// 队列在 Setup 时创建，运行期间不能修改长度
+	if c.QueueSize != p.config.QueueSize {
+		return fmt.Errorf("queue_size can not be reloaded, restart is required to change it from %d to %d", p.config.QueueSize, c.QueueSize)
+	}
+	p.config = c
+
+	return nil
+}
+
+func parseConfig(veteranC *config.VeteranConfig) (webhookConfig, error) {
+
+	tempConfig := struct {
+		C webhookConfig `json:"webhook"`
+	}{}
+
+	if err := json.Unmarshal(veteranC.Raw, &tempConfig); err != nil {
+		return webhookConfig{}, err
+	}
+
+	c := tempConfig.C
+	for _, e := range c.Events {
+		if !events.Known(e) {
+			return webhookConfig{}, fmt.Errorf("unknown webhook event %q", e)
+		}
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = config.Duration(defaultTimeout)
+	}
+	if c.Retries <= 0 {
+		c.Retries = defaultRetries
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = config.Duration(defaultBackoff)
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultQueueSize
+	}
+
+	return c, nil
+}
+
+// Handler 不处理 raft observation，事件通过 events 订阅
+func (p *Webhook) Handler(*raft.Observation) error {
+	return nil
+}
+
+func (c webhookConfig) accept(eventType string) bool {
+
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Webhook) deliver(ctx context.Context, e events.Event) {
+
+	p.lock.RLock()
+	c := p.config
+	p.lock.RUnlock()
+
+	if len(c.Endpoints) == 0 || !c.accept(e.Type) {
+		return
+	}
+
+	body, err := json.Marshal(Event{Event: e, Node: p.id})
+	if err != nil {
+		log.WithError(err).WithField("name", Name).Error("[Plugin] marshal event failed")
+		return
+	}
+
+	for _, endpoint := range c.Endpoints {
+		if err = c.send(ctx, endpoint, body); err != nil {
+			log.WithError(err).WithFields(log.Fields{"name": Name, "endpoint": endpoint, "event": e.Type}).Error("[Plugin] webhook failed")
+		}
+	}
+}
+
+// send 发送请求，失败后按指数退避重试
+func (c webhookConfig) send(ctx context.Context, endpoint string, body []byte) error {
+
+	backoff := time.Duration(c.Backoff)
+
+	var err error
+	for i := 0; i <= c.Retries; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+
+		if err = c.post(ctx, endpoint, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (c webhookConfig) post(ctx context.Context, endpoint string, body []byte) error {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.Timeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	if c.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(c.Secret))
+		mac.Write(body)
+		req.Header.Set(signatureHeader, signaturePrefix+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *Webhook) Shutdown() error {
+
+	if p.consumer == nil {
+		return nil
+	}
+
+	p.consumer.Stop(shutdownTimeout)
+	return nil
+}
+
+func (p *Webhook) Name() string { return Name }
+
+// Filter 不订阅 raft observation，事件通过 events 订阅
+func (p *Webhook) Filter(*raft.Observation) bool {
+	return false
+}
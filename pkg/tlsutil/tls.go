@@ -0,0 +1,62 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/QQGoblin/veteran/pkg/config"
+	"os"
+)
+
+// Load 读取证书、私钥以及 CA，CA 用于校验对端证书，未配置 CA 时返回空
+func Load(c config.TLSConfig) (tls.Certificate, *x509.CertPool, error) {
+
+	cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("load key pair: %s", err)
+	}
+
+	if c.CA == "" {
+		return cert, nil, nil
+	}
+
+	ca, err := os.ReadFile(c.CA)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("read ca: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return tls.Certificate{}, nil, fmt.Errorf("no certificate found in %s", c.CA)
+	}
+
+	return cert, pool, nil
+}
+
+// ClientConfig 创建访问 api 使用的 tls 配置，证书和 CA 都是可选的
+func ClientConfig(c config.TLSConfig) (*tls.Config, error) {
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("load key pair: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.CA != "" {
+		ca, err := os.ReadFile(c.CA)
+		if err != nil {
+			return nil, fmt.Errorf("read ca: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", c.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}